@@ -1,50 +1,285 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"hexgonaldb/internal/adapter/audit"
 	"hexgonaldb/internal/adapter/clickhouse"
+	"hexgonaldb/internal/adapter/dataset"
+	"hexgonaldb/internal/adapter/dlq"
+	httpadapter "hexgonaldb/internal/adapter/http"
+	"hexgonaldb/internal/adapter/metrics"
+	"hexgonaldb/internal/adapter/migrate"
 	"hexgonaldb/internal/adapter/mongo"
 	"hexgonaldb/internal/adapter/postgres"
+	"hexgonaldb/internal/app"
 	"hexgonaldb/internal/app/service"
 	"hexgonaldb/internal/domain"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
 	totalReports  = 5_000_000 // total reports to generate
 	batchSize     = 1000      // how many reports in each batch
 	maxGoroutines = 50        // how many goroutines at the same time
+	seed          = 42        // same seed always generates the same dataset
+	catalogDir    = "catalog" // where the brand, provider and game dimensions are exported
+)
+
+// backendLabels are the names the benchmark output uses for each backend.
+var backendLabels = map[string]string{
+	service.BackendPostgres:   "Postgres",
+	service.BackendMongo:      "MongoDB",
+	service.BackendClickHouse: "ClickHouse",
+	service.DeadLetterOutbox:  "Outbox",
+}
+
+var (
+	serve = flag.Bool("serve", false, "run the HTTP API instead of the benchmark")
+	addr  = flag.String("addr", ":8080", "address the HTTP API listens on")
+
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "with -serve, how long to wait for in-flight requests and benchmarks on SIGTERM/SIGINT")
+
+	datasetPath = flag.String("dataset", "", "seed from a dataset file (.ndjson, .csv or .parquet, optionally .gz/.zst) instead of generating reports")
+	exportPath  = flag.String("export", "", "write the generated (or imported) dataset to this file and exit")
+
+	bufferRows     = flag.Int("buffer-rows", 0, "buffer small writes and flush them together once this many rows accumulate, 0 writes every batch as it comes")
+	bufferDelay    = flag.Duration("buffer-delay", 200*time.Millisecond, "with -buffer-rows, flush at most this long after the first buffered row")
+	bufferWait     = flag.Duration("buffer-wait", time.Minute, "with -buffer-rows, how long a write waits for its flush before it fails and is retried")
+	bufferBackends = flag.String("buffer-backends", service.BackendClickHouse, "with -buffer-rows, comma separated backends to buffer")
+
+	pgInsert = flag.String("pg-insert", service.PostgresInsert, "how batches are written to Postgres: insert (multi-row INSERT through GORM), copy (COPY protocol into a staging table, merged with ON CONFLICT) or copy_direct (COPY straight into reports, fresh ids only)")
+
+	mongoOrdered          = flag.Bool("mongo-ordered", false, "insert Mongo batches in order, stopping at the first error, instead of unordered")
+	mongoW                = flag.String("mongo-w", "", "Mongo write concern w: a number or majority, empty keeps the server default")
+	mongoJournal          = flag.Bool("mongo-j", false, "wait for Mongo to journal every batch")
+	mongoBypassValidation = flag.Bool("mongo-bypass-validation", false, "skip Mongo schema validation on inserts")
+
+	chAppend      = flag.String("ch-append", "row", "how ClickHouse batches are built: row (Append per report) or column (a slice per column)")
+	chAsync       = flag.String("ch-async", "", "insert into ClickHouse with async_insert: wait or nowait (wait_for_async_insert off), empty inserts synchronously")
+	chCompression = flag.String("ch-compression", "lz4", "compression of ClickHouse inserts: lz4, zstd or none")
+
+	retries   = flag.Int("retries", service.DefaultRetryPolicy().MaxAttempts, "attempts per batch and backend before it's dead-lettered, 1 disables retries")
+	dlqPath   = flag.String("dlq", "dead-letters.ndjson", "file batches that failed for good are appended to")
+	replayDLQ = flag.Bool("replay-dlq", false, "resubmit the batches in the -dlq file to the backends that rejected them and exit")
+
+	backfillFrom       = flag.String("backfill-from", "", "copy the reports of this backend into -backfill-to and exit")
+	backfillTo         = flag.String("backfill-to", "", "backend -backfill-from is copied into")
+	backfillSince      = flag.String("backfill-since", "", "with -backfill-from, first bet time to copy (RFC 3339 or YYYY-MM-DD)")
+	backfillUntil      = flag.String("backfill-until", "", "with -backfill-from, bet time to stop before (RFC 3339 or YYYY-MM-DD)")
+	backfillChunk      = flag.Int("backfill-chunk", 5000, "with -backfill-from, reports read and written at a time")
+	backfillRate       = flag.Int("backfill-rate", 0, "with -backfill-from, at most this many reports per second, 0 is unlimited")
+	backfillCheckpoint = flag.String("backfill-checkpoint", "backfill.json", "with -backfill-from, file the progress is saved in and resumed from")
+
+	migrateCmd   = flag.String("migrate", "", "run the Postgres and ClickHouse schema migrations and exit: up, down or status")
+	migrateSteps = flag.Int("migrate-steps", 1, "with -migrate down, how many migrations to revert per backend")
+	autoMigrate  = flag.Bool("auto-migrate", true, "apply pending migrations at startup, when false pending migrations refuse the start")
+
+	erasureLog = flag.String("erasure-log", "erasures.ndjson", "file the audit records of player data deletions are appended to")
+
+	outbox = flag.Bool("outbox", false, "commit reports to Postgres with an outbox entry and relay them to MongoDB and ClickHouse, instead of writing every backend directly")
+
+	// pseudonymizing is meant for production exports passed with -dataset, the HMAC key is read
+	// from PSEUDONYMIZE_KEY so it doesn't end up in the shell history
+	pseudonymize = flag.Bool("pseudonymize", false, "replace usernames, transaction and round ids with keyed hashes (key from $PSEUDONYMIZE_KEY)")
+	jitterTime   = flag.Duration("jitter-time", 0, "with -pseudonymize, shift bet times of each round by up to +/- this duration")
+	jitterAmount = flag.Float64("jitter-amount", 0, "with -pseudonymize, scale amounts of each round by up to +/- this fraction")
+
+	duplicateRate = flag.Float64("duplicate-rate", 0, "fraction of generated reports that replay an earlier transaction_id")
+	lateRate      = flag.Float64("late-rate", 0, "fraction of generated reports settled late, with a bet_time before the generated window")
+	outOfOrder    = flag.Float64("out-of-order", 0, "fraction of generated batches delivered after later batches")
 )
 
 func main() {
+	flag.Parse()
 
 	// runtime.GOMAXPROCS(runtime.NumCPU())
 
+	generator, err := service.NewGenerator(service.GeneratorConfig{
+		Seed:          seed,
+		ReferenceTime: service.DefaultReferenceTime,
+		Profile:       service.RealisticProfile(),
+		Faults: service.Faults{
+			DuplicateRate: *duplicateRate,
+			LateRate:      *lateRate,
+			OutOfOrder:    *outOfOrder,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Error creating generator: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if *exportPath != "" {
+		exportStart := time.Now()
+		batches, sourceErrs := openSource(ctx, generator)
+		written, err := dataset.Export(*exportPath, batches)
+		if err != nil {
+			log.Fatalf("Error exporting dataset: %v", err)
+		}
+		if err := <-sourceErrs; err != nil {
+			log.Fatalf("Error reading dataset: %v", err)
+		}
+		fmt.Printf("Exported %d reports to %s in %s\n", written, *exportPath, time.Since(exportStart))
+		return
+	}
+
 	// Init Database Adapters
 	fmt.Println("Initializing database adapters...")
 
+	appMetrics := metrics.New()
+
 	pgRepo := postgres.NewPostgresRepository()
 	fmt.Printf("[Postgres] connected to PostgreSQL database\n")
 
-	mongoRepo := mongo.NewMongoRepository()
+	mongoRepo := mongo.NewMongoRepository(options.Client().SetPoolMonitor(appMetrics.MongoPoolMonitor(service.BackendMongo)))
 	fmt.Printf("[MongoDB] connected to MongoDB database\n")
 
 	chRepo := clickhouse.NewClickhouseRepository()
 	fmt.Printf("[ClickHouse] connected to ClickHouse database\n\n")
 
+	migrators := schemaMigrators(pgRepo, chRepo)
+	if *migrateCmd != "" {
+		runMigrate(migrators)
+		return
+	}
+	checkSchema(migrators)
+	if err := chRepo.CheckEngine(context.Background()); err != nil {
+		log.Fatalf("ClickHouse schema check failed: %v", err)
+	}
+
 	// pgRepo.ClearAll()
 	// mongoRepo.ClearAll("reports")
 	// chRepo.ClearAll()
 
-	// Init Service
-	appService := service.NewService(pgRepo, mongoRepo, chRepo)
+	appMetrics.RegisterPool(service.BackendPostgres, func() metrics.PoolStats {
+		stats, _ := pgRepo.DBStats()
+		return metrics.PoolStats{Open: stats.OpenConnections, InUse: stats.InUse, Idle: stats.Idle, MaxOpen: stats.MaxOpenConnections}
+	})
+	appMetrics.RegisterPool(service.BackendClickHouse, func() metrics.PoolStats {
+		stats := chRepo.Stats()
+		return metrics.PoolStats{Open: stats.Open, InUse: stats.Open - stats.Idle, Idle: stats.Idle, MaxOpen: stats.MaxOpenConns}
+	})
+
+	// Init Service, the repositories are wrapped so every call shows up on /metrics
+	var (
+		pgPort    = appMetrics.WrapPostgres(pgRepo)
+		mongoPort = appMetrics.WrapMongo(mongoRepo)
+		chPort    = appMetrics.WrapClickhouse(chRepo)
+	)
+
+	// buffers go in front of the metrics so /metrics shows the flushes, not every small write
+	if *bufferRows > 0 {
+		bufferCfg := service.BufferConfig{MaxRows: *bufferRows, MaxDelay: *bufferDelay, MaxPending: *bufferRows * 4, MaxWait: *bufferWait}
+		for _, backend := range strings.Split(*bufferBackends, ",") {
+			switch strings.TrimSpace(backend) {
+			case service.BackendPostgres:
+				pgPort = service.BufferPostgres(pgPort, bufferCfg)
+			case service.BackendMongo:
+				mongoPort = service.BufferMongo(mongoPort, bufferCfg)
+			case service.BackendClickHouse:
+				chPort = service.BufferClickhouse(chPort, bufferCfg)
+			default:
+				log.Fatalf("Unknown backend %q in -buffer-backends", backend)
+			}
+		}
+	}
+
+	appService := service.NewService(pgPort, mongoPort, chPort)
+	appService.SetGenerator(generator)
+
+	writeOptions := service.WriteOptions{
+		PostgresMethod: *pgInsert,
+		Mongo: app.MongoWriteOptions{
+			Ordered:          *mongoOrdered,
+			W:                *mongoW,
+			Journal:          *mongoJournal,
+			BypassValidation: *mongoBypassValidation,
+		},
+		Clickhouse: app.ClickhouseWriteOptions{
+			Append:      *chAppend,
+			AsyncInsert: *chAsync,
+			Compression: *chCompression,
+		},
+	}
+	if err := appService.SetWriteOptions(writeOptions); err != nil {
+		log.Fatalf("Error setting write options: %v", err)
+	}
+
+	retryPolicies := map[string]func(error) bool{
+		service.BackendPostgres:   postgres.IsRetryable,
+		service.BackendMongo:      mongo.IsRetryable,
+		service.BackendClickHouse: clickhouse.IsRetryable,
+	}
+	for backend, retryable := range retryPolicies {
+		policy := service.DefaultRetryPolicy()
+		policy.MaxAttempts = *retries
+		policy.Retryable = retryable
+		appService.SetRetryPolicy(backend, policy)
+	}
+
+	deadLetters := dlq.NewFileStore(*dlqPath)
+	appService.SetDeadLetters(deadLetters)
+	appService.SetErasureLog(audit.NewFileLog(*erasureLog))
+
+	if *replayDLQ {
+		replayDeadLetters(appService, deadLetters)
+		return
+	}
+
+	if *backfillFrom != "" {
+		runBackfill(appService)
+		return
+	}
+
+	var relay *service.Relay
+	if *outbox {
+		if err := appService.EnableOutbox(); err != nil {
+			log.Fatalf("Error enabling outbox: %v", err)
+		}
+		relay = service.NewRelay(appService, service.DefaultRelayConfig())
+		appMetrics.RegisterRelay(relay)
+	}
+
+	if *serve {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		cfg := httpadapter.ServerConfig{Addr: *addr, ShutdownTimeout: *shutdownTimeout, Metrics: appMetrics, Relay: relay}
+		if err := httpadapter.RunServer(ctx, appService, cfg); err != nil {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+		return
+	}
 
 	start := time.Now()
 
+	// the relay catches Mongo and ClickHouse up while Postgres is being seeded
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	if relay != nil {
+		go func() {
+			defer close(relayDone)
+			relay.Run(relayCtx)
+		}()
+	} else {
+		close(relayDone)
+	}
+
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, maxGoroutines) // Semaphore channel
 
@@ -52,73 +287,104 @@ func main() {
 
 	skipInsert := true
 
-	currentReport := totalReports
-	for i := 0; i < batchGenerateReports; i++ {
+	var currentReport atomic.Int64
+	currentReport.Store(totalReports)
+
+	// reports each backend skipped as repeated, see service.DuplicateScope, and buffered
+	// reports flushed with others that it can't tell apart
+	duplicates := make(map[string]*atomic.Int64)
+	unattributed := make(map[string]*atomic.Int64)
+	for _, backend := range appService.Backends() {
+		duplicates[backend] = new(atomic.Int64)
+		unattributed[backend] = new(atomic.Int64)
+	}
+
+	// Reports are generated (or read) while earlier batches are being inserted, only a few batches live at a time
+	batches, sourceErrs := openSource(ctx, generator)
+
+	round := 0
+	for batch := range batches {
 		if skipInsert {
 			fmt.Println("Skipping insert for testing...")
+			cancel()
 			break
 		}
 
-		// Generate reports in batches
-		allReports := appService.GenerateReports(batchSize)
+		round++
+		fmt.Printf("Generating reports... round %d/%d \n", round, batchGenerateReports)
 
-		fmt.Printf("Generating reports... round %d/%d \n", i+1, batchGenerateReports)
-
-		// Split into batches
-		for i := 0; i < len(allReports); i += batchSize {
-			end := i + batchSize
-			if end > len(allReports) {
-				end = len(allReports)
-			}
-			batch := allReports[i:end]
+		wg.Add(1)
+		semaphore <- struct{}{} // acquire slot
 
-			wg.Add(1)
-			semaphore <- struct{}{} // acquire slot
+		go func(batchReports []domain.Report) {
+			defer wg.Done()
+			defer func() { <-semaphore }() // release slot
 
-			go func(batchReports []domain.Report) {
-				defer wg.Done()
-				defer func() { <-semaphore }() // release slot
+			startTime := time.Now()
 
-				startTime := time.Now()
-
-				startTimePostgres := time.Now()
-				// PostgreSQL batch insert
-				if err := pgRepo.CreateManyReports(batchReports); err != nil {
-					log.Printf("[Postgres] batch insert error: %v\n", err)
+			for _, result := range appService.WriteReports(ctx, batchReports) {
+				if !result.Success {
+					log.Printf("[%s] batch insert error after %d attempts (dead-lettered: %t): %s\n", backendLabels[result.Backend], result.Attempts, result.DeadLettered, result.Error)
 				} else {
-					fmt.Println("[Postgres] batch insert success took:", time.Since(startTimePostgres))
+					fmt.Printf("[%s] batch insert success took: %s\n", backendLabels[result.Backend], result.Took)
+					duplicates[result.Backend].Add(int64(result.Duplicates))
+					unattributed[result.Backend].Add(int64(result.Unattributed))
 				}
+			}
 
-				var document []any
-				for _, report := range batchReports {
-					document = append(document, report)
-				}
+			left := currentReport.Add(-int64(len(batchReports)))
+			fmt.Println("left reports left to insert:", left, " percent complete:", 100-(left*100)/totalReports, " %")
+			fmt.Println("All Batch insert took:", time.Since(startTime))
 
-				startTimeMongo := time.Now()
-				// MongoDB batch insert
-				if err := mongoRepo.CreateManyDocuments("reports", document); err != nil {
-					log.Printf("[MongoDB] batch insert error: %v\n", err)
-				} else {
-					fmt.Println("[MongoDB] batch insert success took:", time.Since(startTimeMongo))
-				}
+		}(batch)
+	}
 
-				startTimeClickHouse := time.Now()
-				// ClickHouse batch insert
-				if err := chRepo.InsertManyReportBatch(batchReports); err != nil {
-					log.Printf("[ClickHouse] batch insert error: %v\n", err)
-				} else {
-					fmt.Println("[ClickHouse] batch insert success took:", time.Since(startTimeClickHouse))
-				}
+	wg.Wait()
+
+	if relay != nil {
+		fmt.Println("Waiting for the outbox relay to catch up...")
+		if err := relay.Drain(ctx); err != nil {
+			log.Printf("Outbox relay stopped before catching up: %v\n", err)
+		}
+		for _, status := range relay.Status() {
+			fmt.Printf("[%s] outbox delivered %d entries, %d rows, %d failed attempts\n", backendLabels[status.Target], status.Delivered, status.Rows, status.Failures)
+		}
+	}
+	stopRelay()
+	<-relayDone
 
-				currentReport -= len(batchReports)
-				fmt.Println("left reports left to insert:", currentReport, " percent complete:", 100-(currentReport*100)/totalReports, " %")
-				fmt.Println("All Batch insert took:", time.Since(startTime))
+	if err := <-sourceErrs; err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("Error reading dataset: %v\n", err)
+	}
 
-			}(batch)
+	for _, backend := range appService.Backends() {
+		n := duplicates[backend].Load()
+		switch {
+		case service.DuplicateScope(backend) == service.DuplicatesInBatch:
+			fmt.Printf("[%s] duplicates dropped within batches: %d (repeats of stored rows aren't counted, they collapse on merge)\n", backendLabels[backend], n)
+		case n > 0:
+			fmt.Printf("[%s] duplicates dropped: %d\n", backendLabels[backend], n)
+		}
+		if n := unattributed[backend].Load(); n > 0 {
+			fmt.Printf("[%s] buffered reports not known to be inserted or duplicates: %d\n", backendLabels[backend], n)
 		}
 	}
 
-	wg.Wait()
+	if *datasetPath == "" && generator.Config().Faults.Enabled() {
+		stats := generator.Stats()
+		fmt.Println("----- Fault Injection -----")
+		fmt.Printf("Generated: %d rows, %d duplicates, %d late, %d batches out of order\n", stats.Rows, stats.Duplicates, stats.Late, stats.Reordered)
+
+		faultReports, err := appService.FaultReports(stats)
+		if err != nil {
+			log.Printf("Error building fault report: %v\n", err)
+		}
+		for _, report := range faultReports {
+			fmt.Println(report)
+		}
+		fmt.Println("---------------------")
+		fmt.Println("")
+	}
 
 	// // Measure Read Performance
 	// fmt.Println("\nReading from all databases...")
@@ -147,7 +413,7 @@ func main() {
 	// fmt.Println("---------------------")
 
 	fmt.Println("----- CountDocuments -----")
-	filterCount := bson.M{}
+	filterCount := bson.M{"status": bson.M{"$ne": domain.Void}} // voided bets don't count, like in the other backends
 	mongoTime, mongoCount, err := mongoRepo.CountDocuments("reports", filterCount)
 	if err != nil {
 		log.Printf("Error counting documents in MongoDB: %v\n", err)
@@ -259,3 +525,223 @@ func main() {
 
 	fmt.Println("Done. Total Time:", time.Since(start))
 }
+
+// openSource streams reports from the -dataset file, or from the generator when no file is given,
+// exporting the generator's catalog to catalogDir first.
+// The error channel is closed once the source is exhausted.
+func openSource(ctx context.Context, generator *service.Generator) (<-chan []domain.Report, <-chan error) {
+	var (
+		batches <-chan []domain.Report
+		errs    <-chan error
+	)
+
+	if *datasetPath != "" {
+		reader, err := dataset.Open(*datasetPath)
+		if err != nil {
+			log.Fatalf("Error opening dataset: %v", err)
+		}
+		batches, errs = dataset.Batches(ctx, reader, batchSize)
+		fmt.Println("Seeding from dataset", *datasetPath)
+	} else {
+		// only generated reports refer to the generator's catalog
+		if err := service.WriteCatalog(catalogDir, generator.Catalog()); err != nil {
+			log.Printf("Error exporting catalog: %v\n", err)
+		}
+		batches = generator.Batches(ctx, totalReports, batchSize)
+		noErrs := make(chan error)
+		close(noErrs)
+		errs = noErrs
+	}
+
+	if *pseudonymize {
+		p, err := service.NewPseudonymizer(service.PseudonymizeConfig{
+			Key:          []byte(os.Getenv("PSEUDONYMIZE_KEY")),
+			TimeJitter:   *jitterTime,
+			AmountJitter: *jitterAmount,
+		})
+		if err != nil {
+			log.Fatalf("Error configuring pseudonymizer: %v", err)
+		}
+		batches = p.Stream(ctx, batches)
+	}
+
+	return batches, errs
+}
+
+// replayDeadLetters resubmits every dead-lettered batch to the backend that rejected it,
+// batches of outbox writes to the outbox. Batches failing again are retried and
+// dead-lettered anew, into a fresh -dlq file.
+func replayDeadLetters(appService *service.Service, deadLetters *dlq.FileStore) {
+	start := time.Now()
+
+	stats, err := dlq.Replay(deadLetters.Path(), func(letter domain.DeadLetter) error {
+		var result service.BackendResult
+		if letter.Backend == service.DeadLetterOutbox {
+			result = appService.WriteOutbox(context.Background(), letter.Reports)
+		} else {
+			result = appService.WriteReportsTo(context.Background(), []string{letter.Backend}, letter.Reports)[0]
+		}
+		if !result.Success {
+			log.Printf("[%s] replay of %d reports failed again: %s\n", backendLabels[letter.Backend], len(letter.Reports), result.Error)
+			// failures before any attempt, like a backend that isn't configured, aren't dead-lettered by the write
+			if !result.DeadLettered {
+				if err := deadLetters.Put(letter); err != nil {
+					log.Printf("[%s] dead letter error, %d reports lost: %v\n", backendLabels[letter.Backend], len(letter.Reports), err)
+				}
+			}
+			return errors.New(result.Error)
+		}
+		fmt.Printf("[%s] replayed %d reports (%d duplicates)\n", backendLabels[letter.Backend], result.Rows, result.Duplicates)
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Nothing to replay, %s doesn't exist\n", deadLetters.Path())
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error replaying dead letters: %v", err)
+	}
+
+	fmt.Printf("Replayed %d batches (%d reports) in %s, %d failed again\n", stats.Letters, stats.Reports, time.Since(start), stats.Failed)
+}
+
+// runBackfill copies one backend into another, stopping cleanly on SIGINT/SIGTERM so the
+// next run resumes from the checkpoint.
+func runBackfill(appService *service.Service) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var filter domain.ReportFilter
+	for _, bound := range []struct {
+		value string
+		dest  *time.Time
+	}{{*backfillSince, &filter.From}, {*backfillUntil, &filter.To}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseTime(bound.value)
+		if err != nil {
+			log.Fatalf("Invalid backfill time %q: %v", bound.value, err)
+		}
+		*bound.dest = t
+	}
+
+	cfg := service.BackfillConfig{
+		Source:        *backfillFrom,
+		Target:        *backfillTo,
+		Filter:        filter,
+		ChunkSize:     *backfillChunk,
+		RowsPerSecond: *backfillRate,
+		Checkpoint:    *backfillCheckpoint,
+	}
+	result, err := appService.Backfill(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Backfill stopped after %d reports (%d inserted): %v", result.Rows, result.Inserted, err)
+	}
+
+	fmt.Printf("Backfilled %d reports from %s into %s in %s: %d inserted, %d dead-lettered\n",
+		result.Rows, backendLabels[cfg.Source], backendLabels[cfg.Target], result.Took, result.Inserted, result.DeadLettered)
+	for _, day := range result.Days {
+		if !day.Match() {
+			fmt.Printf("%s mismatch: source %d reports (bet %d, turnover %d), target %d reports (bet %d, turnover %d)\n",
+				day.Date, day.Source.Count, day.Source.Bet, day.Source.Turnover, day.Target.Count, day.Target.Bet, day.Target.Turnover)
+		}
+	}
+	fmt.Printf("Verified %d days, %d mismatched\n", len(result.Days), result.Mismatches)
+	if result.Mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func schemaMigrators(pgRepo *postgres.Repository, chRepo *clickhouse.Repository) []*migrate.Migrator {
+	var migrators []*migrate.Migrator
+	for _, newMigrator := range []func() (*migrate.Migrator, error){pgRepo.Migrator, chRepo.Migrator} {
+		m, err := newMigrator()
+		if err != nil {
+			log.Fatalf("Error loading migrations: %v", err)
+		}
+		migrators = append(migrators, m)
+	}
+	return migrators
+}
+
+// checkSchema refuses to start on a schema that doesn't match the build, migrations
+// changed or unknown to it, and applies pending ones unless -auto-migrate is off.
+func checkSchema(migrators []*migrate.Migrator) {
+	ctx := context.Background()
+
+	for _, m := range migrators {
+		if !*autoMigrate {
+			if err := m.Check(ctx, false); err != nil {
+				log.Fatalf("Schema check failed, run -migrate status: %v", err)
+			}
+			continue
+		}
+
+		applied, err := m.Up(ctx)
+		if err != nil {
+			log.Fatalf("Schema migration failed, run -migrate status: %v", err)
+		}
+		for _, migration := range applied {
+			fmt.Printf("[%s] applied migration %04d_%s\n", backendLabels[m.Backend()], migration.Version, migration.Name)
+		}
+	}
+}
+
+func runMigrate(migrators []*migrate.Migrator) {
+	ctx := context.Background()
+
+	for _, m := range migrators {
+		label := backendLabels[m.Backend()]
+		switch *migrateCmd {
+		case "up":
+			applied, err := m.Up(ctx)
+			for _, migration := range applied {
+				fmt.Printf("[%s] applied %04d_%s\n", label, migration.Version, migration.Name)
+			}
+			if err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			if len(applied) == 0 {
+				fmt.Printf("[%s] up to date\n", label)
+			}
+		case "down":
+			reverted, err := m.Down(ctx, *migrateSteps)
+			for _, migration := range reverted {
+				fmt.Printf("[%s] reverted %04d_%s\n", label, migration.Version, migration.Name)
+			}
+			if err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			if len(reverted) == 0 {
+				fmt.Printf("[%s] nothing to revert\n", label)
+			}
+		case "status":
+			states, err := m.Status(ctx)
+			if err != nil {
+				log.Fatalf("Migration status failed: %v", err)
+			}
+			for _, state := range states {
+				status := "pending"
+				switch {
+				case errors.Is(state.Problem, migrate.ErrChecksumMismatch):
+					status = "changed since applied"
+				case errors.Is(state.Problem, migrate.ErrUnknownMigration):
+					status = "unknown to this build"
+				case state.Applied:
+					status = "applied " + state.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Printf("[%s] %04d_%s %s\n", label, state.Version, state.Name, status)
+			}
+		default:
+			log.Fatalf("Unknown -migrate command %q, use up, down or status", *migrateCmd)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileLog appends erasure records to a local NDJSON file, one deletion per line. The file
+// is only ever appended to, and every Put is synced before it returns.
+type FileLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileLog(path string) *FileLog {
+	return &FileLog{path: path}
+}
+
+func (l *FileLog) Path() string {
+	return l.path
+}
+
+func (l *FileLog) Put(erasure domain.Erasure) error {
+	line, err := json.Marshal(erasure)
+	if err != nil {
+		return fmt.Errorf("erasure encode error: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if dir := filepath.Dir(l.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("erasure log dir error: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("erasure log open error: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("erasure log write error: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("erasure log sync error: %w", err)
+	}
+	return f.Close()
+}
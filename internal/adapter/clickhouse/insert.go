@@ -0,0 +1,215 @@
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/domain"
+	"time"
+
+	clickhouse_go "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+var compressionMethods = map[string]clickhouse_go.CompressionMethod{
+	"":     clickhouse_go.CompressionLZ4,
+	"lz4":  clickhouse_go.CompressionLZ4,
+	"zstd": clickhouse_go.CompressionZSTD,
+	"none": clickhouse_go.CompressionNone,
+}
+
+// InsertReports inserts the reports, the highest version of each transaction id in the
+// batch, and returns how many rows were sent. Nothing is looked up first, which would slow
+// every insert down and skew the comparison of append, async and compression modes: rows
+// of transaction ids stored before, in that version or another, are inserted too and
+// ReplacingMergeTree(version) collapses them on merge, while queries read FINAL meanwhile.
+// Duplicates of earlier batches are therefore counted as inserted; the same goes for rows
+// still waiting in the server's async insert buffer.
+func (r *Repository) InsertReports(reports []domain.Report, opts app.ClickhouseWriteOptions) (int64, error) {
+	ctx := context.Background()
+
+	if len(reports) == 0 {
+		return 0, nil
+	}
+
+	conn, err := r.writer(opts.Compression)
+	if err != nil {
+		return 0, err
+	}
+
+	fresh := latestVersions(reports)
+
+	switch opts.AsyncInsert {
+	case "":
+	case "wait", "nowait":
+		ctx = clickhouse_go.Context(ctx, clickhouse_go.WithSettings(clickhouse_go.Settings{
+			"async_insert":          1,
+			"wait_for_async_insert": boolSetting(opts.AsyncInsert == "wait"),
+		}))
+	default:
+		return 0, fmt.Errorf("unknown async insert mode %q", opts.AsyncInsert)
+	}
+
+	batch, err := conn.PrepareBatch(ctx, `
+	INSERT INTO reports (
+		username,
+		username_game,
+		currency,
+		winloss,
+		bet,
+		turnover,
+		payout,
+		bet_time,
+		brand_id,
+		brand_name,
+		game_id,
+		game_name,
+		game_type,
+		transaction_id,
+		round_id,
+		status,
+		version
+		)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare batch error: %w", err)
+	}
+
+	switch opts.Append {
+	case "", "row":
+		err = appendRows(batch, fresh)
+	case "column":
+		err = appendColumns(batch, fresh)
+	default:
+		err = fmt.Errorf("unknown append mode %q", opts.Append)
+	}
+	if err != nil {
+		return 0, errors.Join(fmt.Errorf("append batch error: %w", err), batch.Abort())
+	}
+
+	if err := batch.Send(); err != nil {
+		return 0, fmt.Errorf("send batch error: %w", err)
+	}
+
+	return int64(len(fresh)), nil
+}
+
+// writer returns the connection inserts with the given compression go through. Compression
+// is negotiated per connection, so every method but the default LZ4 gets its own.
+func (r *Repository) writer(compression string) (clickhouse_go.Conn, error) {
+	method, ok := compressionMethods[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q, use lz4, zstd or none", compression)
+	}
+	if method == clickhouse_go.CompressionLZ4 {
+		return r.db, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writers == nil {
+		return nil, errors.New("ClickHouse repository is closed")
+	}
+	if conn, ok := r.writers[method]; ok {
+		return conn, nil
+	}
+
+	conn, err := clickhouse_go.Open(connOptions(method))
+	if err != nil {
+		return nil, fmt.Errorf("ClickHouse %s connection error: %w", compression, err)
+	}
+	r.writers[method] = conn
+	return conn, nil
+}
+
+// latestVersions keeps the highest version of every transaction id in the batch, in order.
+func latestVersions(reports []domain.Report) []domain.Report {
+	latest := make(map[string]int, len(reports)) // transaction id to index in kept
+	kept := make([]domain.Report, 0, len(reports))
+	for _, report := range reports {
+		i, ok := latest[report.TransactionID]
+		switch {
+		case !ok:
+			latest[report.TransactionID] = len(kept)
+			kept = append(kept, report)
+		case report.Version > kept[i].Version:
+			kept[i] = report
+		}
+	}
+	return kept
+}
+
+func appendRows(batch driver.Batch, reports []domain.Report) error {
+	for _, r := range reports {
+		if err := batch.Append(
+			r.Username,
+			r.UsernameGame,
+			r.Currency,
+			r.Winloss,
+			r.Bet,
+			r.Turnover,
+			r.Payout,
+			r.BetTime,
+			r.BrandID,
+			r.BrandName,
+			r.GameID,
+			r.GameName,
+			r.GameType,
+			r.TransactionID,
+			r.RoundID,
+			string(r.Status),
+			r.Version,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendColumns hands the driver one slice per column, in the order of the INSERT, which
+// saves the per row type switch of Append.
+func appendColumns(batch driver.Batch, reports []domain.Report) error {
+	columns := []any{
+		column(reports, func(r domain.Report) string { return r.Username }),
+		column(reports, func(r domain.Report) string { return r.UsernameGame }),
+		column(reports, func(r domain.Report) string { return r.Currency }),
+		column(reports, func(r domain.Report) int64 { return r.Winloss }),
+		column(reports, func(r domain.Report) int64 { return r.Bet }),
+		column(reports, func(r domain.Report) int64 { return r.Turnover }),
+		column(reports, func(r domain.Report) float64 { return r.Payout }),
+		column(reports, func(r domain.Report) time.Time { return r.BetTime }),
+		column(reports, func(r domain.Report) string { return r.BrandID }),
+		column(reports, func(r domain.Report) string { return r.BrandName }),
+		column(reports, func(r domain.Report) string { return r.GameID }),
+		column(reports, func(r domain.Report) string { return r.GameName }),
+		column(reports, func(r domain.Report) string { return r.GameType }),
+		column(reports, func(r domain.Report) string { return r.TransactionID }),
+		column(reports, func(r domain.Report) string { return r.RoundID }),
+		column(reports, func(r domain.Report) string { return string(r.Status) }),
+		column(reports, func(r domain.Report) uint32 { return r.Version }),
+	}
+
+	for i, values := range columns {
+		if err := batch.Column(i).Append(values); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func column[T any](reports []domain.Report, field func(domain.Report) T) []T {
+	values := make([]T, len(reports))
+	for i, report := range reports {
+		values[i] = field(report)
+	}
+	return values
+}
+
+func boolSetting(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package clickhouse
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"hexgonaldb/internal/adapter/migrate"
+	"io/fs"
+	"strings"
+	"time"
+
+	clickhouse_go "github.com/ClickHouse/clickhouse-go/v2"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrator returns the migrator of the ClickHouse schema.
+func (r *Repository) Migrator() (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New("clickhouse", migrationDriver{r.db}, files)
+}
+
+// migrationDriver keeps the state in a ReplacingMergeTree, reverting inserts a newer row
+// with applied = 0 rather than deleting through a mutation. ClickHouse has no transactions,
+// a migration failing halfway has to be finished or undone by hand.
+type migrationDriver struct {
+	db clickhouse_go.Conn
+}
+
+func (d migrationDriver) EnsureStateTable(ctx context.Context) error {
+	return d.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version UInt32,
+		name String,
+		checksum String,
+		applied UInt8,
+		changed_at DateTime64(9)
+	) ENGINE = ReplacingMergeTree(changed_at) ORDER BY version
+	`)
+}
+
+func (d migrationDriver) Applied(ctx context.Context) ([]migrate.Applied, error) {
+	rows, err := d.db.Query(ctx, "SELECT version, name, checksum, changed_at FROM schema_migrations FINAL WHERE applied = 1 ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []migrate.Applied
+	for rows.Next() {
+		var (
+			a       migrate.Applied
+			version uint32
+		)
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		a.Version = int(version)
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+func (d migrationDriver) Apply(ctx context.Context, m migrate.Migration) error {
+	skip, err := d.upToDate(ctx, m)
+	if err != nil {
+		return err
+	}
+	if !skip {
+		if err := d.exec(ctx, m.Up); err != nil {
+			return err
+		}
+	}
+	return d.record(ctx, m, true)
+}
+
+// upToDate tells whether the database already is what a migration would make it, Apply then
+// only records it. Rebuilding reports copies every row, 0003 is skipped when the engine is
+// right, as on tables created by 0001.
+func (d migrationDriver) upToDate(ctx context.Context, m migrate.Migration) (bool, error) {
+	if m.Name != "reports_replacing_engine" {
+		return false, nil
+	}
+	engineFull, sortingKey, err := reportsEngine(ctx, d.db)
+	if err != nil {
+		return false, err
+	}
+	return replacingEngine(engineFull, sortingKey), nil
+}
+
+func (d migrationDriver) Revert(ctx context.Context, m migrate.Migration) error {
+	if err := d.exec(ctx, m.Down); err != nil {
+		return err
+	}
+	return d.record(ctx, m, false)
+}
+
+// exec lifts the connection's max_execution_time, rebuilding a table copies all of it.
+func (d migrationDriver) exec(ctx context.Context, statements []string) error {
+	ctx = clickhouse_go.Context(ctx, clickhouse_go.WithSettings(clickhouse_go.Settings{"max_execution_time": 0}))
+	for i, stmt := range statements {
+		if err := d.db.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (d migrationDriver) record(ctx context.Context, m migrate.Migration, applied bool) error {
+	err := d.db.Exec(ctx, "INSERT INTO schema_migrations (version, name, checksum, applied, changed_at) VALUES (?, ?, ?, ?, ?)",
+		uint32(m.Version), m.Name, m.Checksum, boolSetting(applied), time.Now())
+	if err != nil {
+		return fmt.Errorf("migration state error: %w", err)
+	}
+	return nil
+}
+
+// CheckEngine fails unless reports is a ReplacingMergeTree(version) sorted by (bet_time,
+// transaction_id). Any other table keeps duplicates and counts corrections next to the bets
+// they correct, migration 0003 converts it.
+func (r *Repository) CheckEngine(ctx context.Context) error {
+	engineFull, sortingKey, err := reportsEngine(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	if !replacingEngine(engineFull, sortingKey) {
+		return fmt.Errorf("reports table is %q, want ReplacingMergeTree(version) ORDER BY (bet_time, transaction_id)", engineFull)
+	}
+	return nil
+}
+
+func reportsEngine(ctx context.Context, db clickhouse_go.Conn) (engineFull, sortingKey string, err error) {
+	err = db.QueryRow(ctx, "SELECT engine_full, sorting_key FROM system.tables WHERE database = currentDatabase() AND name = 'reports'").Scan(&engineFull, &sortingKey)
+	if err != nil {
+		return "", "", fmt.Errorf("reports table lookup error: %w", err)
+	}
+	return engineFull, sortingKey, nil
+}
+
+func replacingEngine(engineFull, sortingKey string) bool {
+	return strings.HasPrefix(engineFull, "ReplacingMergeTree(version)") && sortingKey == "bet_time, transaction_id"
+}
@@ -0,0 +1,20 @@
+-- IF NOT EXISTS adopts tables created before migrations existed
+CREATE TABLE IF NOT EXISTS reports (
+	username String,
+	username_game String,
+	currency String,
+	winloss Int64,
+	bet Int64,
+	turnover Int64,
+	payout Float64,
+	bet_time DateTime,
+	brand_id String,
+	brand_name String,
+	game_id String,
+	game_name String,
+	game_type String,
+	transaction_id String,
+	round_id String,
+	status LowCardinality(String) DEFAULT 'settled',
+	version UInt32 DEFAULT 1
+) ENGINE = ReplacingMergeTree(version) ORDER BY (bet_time, transaction_id);
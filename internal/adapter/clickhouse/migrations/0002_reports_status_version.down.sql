@@ -0,0 +1,4 @@
+-- 0003 down has taken version out of the engine, so both columns can go
+ALTER TABLE reports
+	DROP COLUMN IF EXISTS version,
+	DROP COLUMN IF EXISTS status;
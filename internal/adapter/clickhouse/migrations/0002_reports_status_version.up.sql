@@ -0,0 +1,4 @@
+-- tables created before corrections existed, new ones have both columns since 0001
+ALTER TABLE reports
+	ADD COLUMN IF NOT EXISTS status LowCardinality(String) DEFAULT 'settled',
+	ADD COLUMN IF NOT EXISTS version UInt32 DEFAULT 1;
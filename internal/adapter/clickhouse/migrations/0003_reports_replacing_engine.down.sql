@@ -0,0 +1,11 @@
+-- back to the engine before corrections, deduplicated by transaction without versions
+DROP TABLE IF EXISTS reports_migrating;
+
+CREATE TABLE reports_migrating AS reports
+ENGINE = ReplacingMergeTree ORDER BY (bet_time, transaction_id);
+
+INSERT INTO reports_migrating SELECT * FROM reports;
+
+EXCHANGE TABLES reports AND reports_migrating;
+
+DROP TABLE reports_migrating;
@@ -2,22 +2,29 @@ package clickhouse
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hexgonaldb/internal/app"
 	"hexgonaldb/internal/app/service"
 	"hexgonaldb/internal/domain"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	clickhouse_go "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
 type Repository struct {
 	db clickhouse_go.Conn
+
+	mu      sync.Mutex
+	writers map[clickhouse_go.CompressionMethod]clickhouse_go.Conn // extra connections for inserts with another compression
 }
 
-// NewClickhouseRepository initializes a new connection
-func NewClickhouseRepository() *Repository {
-	conn, err := clickhouse_go.Open(&clickhouse_go.Options{
+func connOptions(compression clickhouse_go.CompressionMethod) *clickhouse_go.Options {
+	return &clickhouse_go.Options{
 		Addr: []string{"localhost:9000"},
 		Auth: clickhouse_go.Auth{
 			Database: "default",
@@ -30,40 +37,42 @@ func NewClickhouseRepository() *Repository {
 			// "max_insert_block_size": 100000, // how many rows ClickHouse will buffer per insert batch
 		},
 		Compression: &clickhouse_go.Compression{
-			Method: clickhouse_go.CompressionLZ4,
+			Method: compression,
 		},
 		// Debug: true,
-	})
+	}
+}
+
+// NewClickhouseRepository initializes a new connection
+func NewClickhouseRepository() *Repository {
+	conn, err := clickhouse_go.Open(connOptions(clickhouse_go.CompressionLZ4))
 	if err != nil {
 		log.Fatalf("failed to connect to ClickHouse: %v", err)
 	}
 
-	ctx := context.Background()
-	// create table if not exist
-	err = conn.Exec(ctx, `
-	CREATE TABLE IF NOT EXISTS reports (
-		username String,
-		username_game String,
-		currency String,
-		winloss Int64,
-		bet Int64,
-		turnover Int64,
-		payout Float64,
-		bet_time DateTime,
-		brand_id String,
-		brand_name String,
-		game_id String,
-		game_name String,
-		game_type String,
-		transaction_id String,
-		round_id String
-	) ENGINE = MergeTree() ORDER BY (bet_time)
-	`)
-	if err != nil {
-		log.Fatalf("failed to create table: %v", err)
+	// the schema is kept by migrations, see Migrator and CheckEngine
+	return &Repository{db: conn, writers: make(map[clickhouse_go.CompressionMethod]clickhouse_go.Conn)}
+}
+
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.Ping(ctx)
+}
+
+func (r *Repository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errs := []error{r.db.Close()}
+	for _, conn := range r.writers {
+		errs = append(errs, conn.Close())
 	}
+	r.writers = nil
+	return errors.Join(errs...)
+}
 
-	return &Repository{db: conn}
+// Stats returns the connection pool stats.
+func (r *Repository) Stats() driver.Stats {
+	return r.db.Stats()
 }
 
 // InsertReport inserts one report record into ClickHouse
@@ -161,59 +170,62 @@ func (r *Repository) InsertManyReport(report []domain.Report) error {
 	return nil
 }
 
-func (r *Repository) InsertManyReportBatch(report []domain.Report) error {
+// retryableCodes are ClickHouse exceptions caused by load or the network rather than the data.
+var retryableCodes = map[int32]bool{
+	159: true, // TIMEOUT_EXCEEDED
+	202: true, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203: true, // NO_FREE_CONNECTION
+	209: true, // SOCKET_TIMEOUT
+	210: true, // NETWORK_ERROR
+	241: true, // MEMORY_LIMIT_EXCEEDED
+	242: true, // TABLE_IS_READ_ONLY
+	252: true, // TOO_MANY_PARTS
+	425: true, // SYSTEM_ERROR
+}
+
+// IsRetryable tells transient ClickHouse failures from permanent ones.
+func IsRetryable(err error) bool {
+	var exception *clickhouse_go.Exception
+	if errors.As(err, &exception) {
+		return retryableCodes[exception.Code]
+	}
+	return errors.Is(err, clickhouse_go.ErrAcquireConnTimeout) || service.IsTransient(err)
+}
+
+// BetTimes returns the bet time of every transaction id that is stored, of its latest
+// version when merges haven't collapsed them yet.
+func (r *Repository) BetTimes(transactionIDs []string) (map[string]time.Time, error) {
 	ctx := context.Background()
 
-	batch, err := r.db.PrepareBatch(ctx, `
-	INSERT INTO reports (
-		username,
-		username_game,
-		currency,
-		winloss,
-		bet,
-		turnover,
-		payout,
-		bet_time,
-		brand_id,
-		brand_name,
-		game_id,
-		game_name,
-		game_type,
-		transaction_id,
-		round_id
-		)
-	`)
+	rows, err := r.db.Query(ctx, `
+		SELECT transaction_id, argMax(bet_time, version)
+		FROM reports
+		WHERE has(?, transaction_id)
+		GROUP BY transaction_id
+	`, transactionIDs)
 	if err != nil {
-		return fmt.Errorf("prepare batch error: %w", err)
-	}
-
-	for _, r := range report {
-		if err := batch.Append(
-			r.Username,
-			r.UsernameGame,
-			r.Currency,
-			r.Winloss,
-			r.Bet,
-			r.Turnover,
-			r.Payout,
-			r.BetTime,
-			r.BrandID,
-			r.BrandName,
-			r.GameID,
-			r.GameName,
-			r.GameType,
-			r.TransactionID,
-			r.RoundID,
-		); err != nil {
-			return fmt.Errorf("append batch error: %w", err)
-		}
+		return nil, err
 	}
+	defer rows.Close()
 
-	if err := batch.Send(); err != nil {
-		return fmt.Errorf("send batch error: %w", err)
+	betTimes := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			id      string
+			betTime time.Time
+		)
+		if err := rows.Scan(&id, &betTime); err != nil {
+			return nil, err
+		}
+		betTimes[id] = betTime
 	}
+	return betTimes, rows.Err()
+}
 
-	return nil
+// InsertManyReportBatch inserts the reports row by row over the default connection, see
+// InsertReports.
+func (r *Repository) InsertManyReportBatch(report []domain.Report) (int64, error) {
+	return r.InsertReports(report, app.ClickhouseWriteOptions{})
 }
 
 func (r *Repository) FindAllReports() (time.Duration, []domain.Report, error) {
@@ -222,7 +234,7 @@ func (r *Repository) FindAllReports() (time.Duration, []domain.Report, error) {
 	ctx := context.Background()
 	var reports []domain.Report
 
-	query := "SELECT * FROM reports"
+	query := "SELECT " + reportSelect + " FROM reports FINAL"
 	rows, err := r.db.Query(ctx, query)
 	if err != nil {
 		errTime := time.Since(startTime)
@@ -231,24 +243,8 @@ func (r *Repository) FindAllReports() (time.Duration, []domain.Report, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var report domain.Report
-		if err := rows.Scan(
-			&report.Username,
-			&report.UsernameGame,
-			&report.Currency,
-			&report.Winloss,
-			&report.Bet,
-			&report.Turnover,
-			&report.Payout,
-			&report.BetTime,
-			&report.BrandID,
-			&report.BrandName,
-			&report.GameID,
-			&report.GameName,
-			&report.GameType,
-			&report.TransactionID,
-			&report.RoundID,
-		); err != nil {
+		report, err := scanReport(rows)
+		if err != nil {
 			errTime := time.Since(startTime)
 			return errTime, nil, err
 		}
@@ -267,7 +263,8 @@ func (r *Repository) QueryReport() (time.Duration, []domain.ProfitAggregationRes
 		SELECT 
 			game_name, 
 			SUM(winloss) AS total_profit
-		FROM reports
+		FROM reports FINAL
+		WHERE status != 'void'
 		GROUP BY game_name
 		ORDER BY total_profit DESC
 	`
@@ -305,7 +302,7 @@ func (r *Repository) QueryReport2() (time.Duration, []domain.SuperAggregationRes
 	startTime := time.Now()
 	clickQuery := `
 		SELECT 
-    		formatDateTime(bet_time, '%Y-%m-%d') AS date,
+    		formatDateTime(toTimeZone(bet_time, 'UTC'), '%Y-%m-%d') AS date,
     		brand_id,
     		game_name,
     		SUM(bet) AS total_bet,
@@ -313,7 +310,8 @@ func (r *Repository) QueryReport2() (time.Duration, []domain.SuperAggregationRes
     		AVG(payout) AS average_payout,
     		COUNT(*) AS total_count,
    			SUM(if(winloss > 0, winloss, 0)) AS positive_win
-		FROM reports
+		FROM reports FINAL
+		WHERE status != 'void'
 		GROUP BY date, brand_id, game_name
 		ORDER BY date, brand_id, game_name;
 	`
@@ -350,7 +348,7 @@ func (r *Repository) CountReports() (time.Duration, int64, error) {
 
 	ctx := context.Background()
 
-	query := "SELECT COUNT(*) FROM reports"
+	query := "SELECT COUNT(*) FROM reports FINAL"
 	var count *uint64
 	err := r.db.QueryRow(ctx, query).Scan(&count)
 	if err != nil {
@@ -377,3 +375,257 @@ func (r *Repository) ClearAll() error {
 
 	return nil
 }
+
+// mutationTimeout bounds how long DeletePlayerData waits for its mutation to finish.
+const mutationTimeout = 10 * time.Minute
+
+// DeletePlayerData deletes every report of username with an ALTER TABLE ... DELETE
+// mutation and waits until ClickHouse has rewritten the affected parts. Returns the rows
+// counted before the delete, unmerged duplicates included.
+func (r *Repository) DeletePlayerData(username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mutationTimeout)
+	defer cancel()
+
+	var count uint64
+	if err := r.db.QueryRow(ctx, "SELECT count() FROM reports WHERE username = ?", username).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count error: %w", err)
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	// mutations_sync waits for this very mutation, on every replica, and fails with its
+	// reason when it keeps failing; ClickHouse retries it in the background regardless
+	ctx = clickhouse_go.Context(ctx, clickhouse_go.WithSettings(clickhouse_go.Settings{"mutations_sync": 2, "max_execution_time": 0}))
+	if err := r.db.Exec(ctx, "ALTER TABLE reports DELETE WHERE username = ?", username); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return 0, fmt.Errorf("delete mutation still running after %s: %w", mutationTimeout, err)
+		}
+		return 0, fmt.Errorf("delete mutation error: %w", err)
+	}
+	return int64(count), nil
+}
+
+// reportWhere builds the WHERE clause for f, with positional ? placeholders.
+func reportWhere(f domain.ReportFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	if !f.From.IsZero() {
+		conds = append(conds, "bet_time >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "bet_time < ?")
+		args = append(args, f.To)
+	}
+	if f.BrandID != "" {
+		conds = append(conds, "brand_id = ?")
+		args = append(args, f.BrandID)
+	}
+	if f.GameID != "" {
+		conds = append(conds, "game_id = ?")
+		args = append(args, f.GameID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// settledWhere is reportWhere for aggregations, voided bets don't count. Aggregations read
+// FINAL, so a corrected bet only counts in its latest version.
+func settledWhere(f domain.ReportFilter) (string, []any) {
+	where, args := reportWhere(f)
+	if where == "" {
+		return "WHERE status != 'void'", args
+	}
+	return where + " AND status != 'void'", args
+}
+
+// reportSelect lists the columns scanReport reads, in order.
+const reportSelect = `username, username_game, currency, winloss, bet, turnover, payout, bet_time,
+	brand_id, brand_name, game_id, game_name, game_type, transaction_id, round_id, status, version`
+
+func scanReport(rows driver.Rows) (domain.Report, error) {
+	var (
+		report domain.Report
+		status string
+	)
+	err := rows.Scan(
+		&report.Username,
+		&report.UsernameGame,
+		&report.Currency,
+		&report.Winloss,
+		&report.Bet,
+		&report.Turnover,
+		&report.Payout,
+		&report.BetTime,
+		&report.BrandID,
+		&report.BrandName,
+		&report.GameID,
+		&report.GameName,
+		&report.GameType,
+		&report.TransactionID,
+		&report.RoundID,
+		&status,
+		&report.Version,
+	)
+	report.Status = domain.ReportStatus(status)
+	return report, err
+}
+
+// bucketExpr buckets in UTC like the other backends, bet_time is a DateTime without a time
+// zone and would be formatted in the server's.
+func bucketExpr(g domain.Granularity) string {
+	switch g {
+	case domain.Hour:
+		return "formatDateTime(toTimeZone(bet_time, 'UTC'), '%Y-%m-%d %H:00')"
+	case domain.Week:
+		return "formatDateTime(toMonday(toTimeZone(bet_time, 'UTC')), '%Y-%m-%d')"
+	case domain.Month:
+		return "formatDateTime(toTimeZone(bet_time, 'UTC'), '%Y-%m')"
+	default:
+		return "formatDateTime(toTimeZone(bet_time, 'UTC'), '%Y-%m-%d')"
+	}
+}
+
+func (r *Repository) CountReportsWhere(f domain.ReportFilter) (time.Duration, int64, error) {
+	startTime := time.Now()
+
+	ctx := context.Background()
+
+	where, args := reportWhere(f)
+	var count uint64
+	if err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM reports FINAL "+where, args...).Scan(&count); err != nil {
+		return time.Since(startTime), 0, fmt.Errorf("ClickHouse query error: %w", err)
+	}
+
+	return time.Since(startTime), int64(count), nil
+}
+
+func (r *Repository) ProfitByGame(f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+
+	where, args := settledWhere(f)
+	clickQuery := `
+		SELECT
+			game_name,
+			SUM(winloss) AS total_profit
+		FROM reports FINAL
+		` + where + `
+		GROUP BY game_name
+		ORDER BY total_profit DESC
+	`
+
+	ctx := context.Background()
+
+	rows, err := r.db.Query(ctx, clickQuery, args...)
+	if err != nil {
+		return time.Since(startTime), []domain.ProfitAggregationResult{}, fmt.Errorf("ClickHouse query error: %w", err)
+	}
+	defer rows.Close()
+
+	var allReports []domain.ProfitAggregationResult
+	for rows.Next() {
+		var r domain.ProfitAggregationResult
+		if err := rows.Scan(&r.GameName, &r.TotalProfit); err != nil {
+			return time.Since(startTime), []domain.ProfitAggregationResult{}, fmt.Errorf("ClickHouse scan error: %w", err)
+		}
+		allReports = append(allReports, r)
+	}
+
+	return time.Since(startTime), allReports, rows.Err()
+}
+
+// Rollup is QueryReport2 with a filter and a choice of time bucket.
+func (r *Repository) Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	startTime := time.Now()
+
+	where, args := settledWhere(f)
+	clickQuery := `
+		SELECT
+			` + bucketExpr(g) + ` AS date,
+			brand_id,
+			game_name,
+			SUM(bet) AS total_bet,
+			SUM(turnover) AS total_turnover,
+			AVG(payout) AS average_payout,
+			COUNT(*) AS total_count,
+			SUM(if(winloss > 0, winloss, 0)) AS positive_win,
+			SUM(winloss) AS total_winloss
+		FROM reports FINAL
+		` + where + `
+		GROUP BY date, brand_id, game_name
+		ORDER BY date, brand_id, game_name
+	`
+
+	ctx := context.Background()
+
+	rows, err := r.db.Query(ctx, clickQuery, args...)
+	if err != nil {
+		return time.Since(startTime), []domain.SuperAggregationResult{}, fmt.Errorf("ClickHouse query error: %w", err)
+	}
+	defer rows.Close()
+
+	var allReports []domain.SuperAggregationResult
+	for rows.Next() {
+		var r domain.SuperAggregationResult
+		if err := rows.Scan(&r.Date, &r.BrandID, &r.GameName, &r.TotalBet, &r.TotalTurnover, &r.AveragePayout, &r.TotalCount, &r.PositiveWin, &r.TotalWinloss); err != nil {
+			return time.Since(startTime), []domain.SuperAggregationResult{}, fmt.Errorf("ClickHouse scan error: %w", err)
+		}
+		allReports = append(allReports, r)
+	}
+
+	return time.Since(startTime), allReports, rows.Err()
+}
+
+// ListReports returns up to limit reports after the cursor in (bet_time, transaction_id)
+// order. bet_time leads the sorting key, so the seek skips whole granules instead of
+// reading and discarding an OFFSET.
+func (r *Repository) ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error) {
+	startTime := time.Now()
+
+	ctx := context.Background()
+
+	where, args := reportWhere(f)
+	if after != nil {
+		if where == "" {
+			where = "WHERE "
+		} else {
+			where += " AND "
+		}
+		where += "(bet_time, transaction_id) > (?, ?)"
+		args = append(args, after.BetTime, after.TransactionID)
+	}
+	args = append(args, limit)
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+reportSelect+`
+		FROM reports FINAL
+		`+where+`
+		ORDER BY bet_time, transaction_id
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return time.Since(startTime), nil, fmt.Errorf("ClickHouse query error: %w", err)
+	}
+	defer rows.Close()
+
+	reports := make([]domain.Report, 0, limit)
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return time.Since(startTime), nil, fmt.Errorf("ClickHouse scan error: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return time.Since(startTime), nil, fmt.Errorf("ClickHouse rows error: %w", err)
+	}
+
+	return time.Since(startTime), reports, nil
+}
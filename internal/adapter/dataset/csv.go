@@ -0,0 +1,221 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvColumns is the header every CSV dataset is written with and must be read with.
+var csvColumns = []string{
+	"username",
+	"username_game",
+	"currency",
+	"winloss",
+	"bet",
+	"turnover",
+	"payout",
+	"bet_time",
+	"brand_id",
+	"brand_name",
+	"game_id",
+	"game_name",
+	"game_type",
+	"transaction_id",
+	"round_id",
+	"status",
+	"version",
+}
+
+// csvOptional are the columns of datasets written before corrections existed may lack,
+// their reports are settled, version 1.
+var csvOptional = map[string]bool{"status": true, "version": true}
+
+type csvWriter struct {
+	w   io.WriteCloser
+	csv *csv.Writer
+}
+
+func newCSVWriter(w io.WriteCloser) (*csvWriter, error) {
+	cw := &csvWriter{w: w, csv: csv.NewWriter(w)}
+	if err := cw.csv.Write(csvColumns); err != nil {
+		return nil, fmt.Errorf("csv header error: %w", err)
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) Write(reports []domain.Report) error {
+	for _, r := range reports {
+		if err := w.csv.Write(MarshalCSV(r)); err != nil {
+			return fmt.Errorf("csv write error: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		w.w.Close()
+		return fmt.Errorf("csv flush error: %w", err)
+	}
+	return w.w.Close()
+}
+
+type csvReader struct {
+	rc    io.ReadCloser
+	csv   *csv.Reader
+	index map[string]int
+	line  int
+}
+
+func newCSVReader(rc io.ReadCloser) (*csvReader, error) {
+	r := csv.NewReader(rc)
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header error: %w", err)
+	}
+
+	index, err := CSVHeaderIndex(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csvReader{rc: rc, csv: r, index: index, line: 1}, nil
+}
+
+func (r *csvReader) Read(n int) ([]domain.Report, error) {
+	reports := make([]domain.Report, 0, n)
+
+	for len(reports) < n {
+		record, err := r.csv.Read()
+		if errors.Is(err, io.EOF) {
+			return reports, io.EOF
+		}
+		r.line++
+		if err != nil {
+			return reports, fmt.Errorf("csv read error: %w", err)
+		}
+
+		report, err := UnmarshalCSV(record, r.index)
+		if err != nil {
+			return reports, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.rc.Close()
+}
+
+// CSVHeaderIndex maps each expected column to its position in header. Columns may come
+// in any order but all of them, optional ones aside, must be present and no others are allowed.
+func CSVHeaderIndex(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(csvColumns))
+	for _, c := range csvColumns {
+		known[c] = true
+	}
+
+	index := make(map[string]int, len(header))
+	for i, c := range header {
+		if !known[c] {
+			return nil, fmt.Errorf("csv schema error: unknown column %q", c)
+		}
+		index[c] = i
+	}
+
+	for _, c := range csvColumns {
+		if _, ok := index[c]; !ok && !csvOptional[c] {
+			return nil, fmt.Errorf("csv schema error: missing column %q", c)
+		}
+	}
+
+	return index, nil
+}
+
+func MarshalCSV(r domain.Report) []string {
+	return []string{
+		r.Username,
+		r.UsernameGame,
+		r.Currency,
+		strconv.FormatInt(r.Winloss, 10),
+		strconv.FormatInt(r.Bet, 10),
+		strconv.FormatInt(r.Turnover, 10),
+		strconv.FormatFloat(r.Payout, 'g', -1, 64),
+		r.BetTime.UTC().Format(time.RFC3339Nano),
+		r.BrandID,
+		r.BrandName,
+		r.GameID,
+		r.GameName,
+		r.GameType,
+		r.TransactionID,
+		r.RoundID,
+		string(r.Status),
+		strconv.FormatUint(uint64(r.Version), 10),
+	}
+}
+
+func UnmarshalCSV(record []string, index map[string]int) (domain.Report, error) {
+	get := func(column string) string {
+		if i, ok := index[column]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	var (
+		report domain.Report
+		err    error
+	)
+
+	report.Username = get("username")
+	report.UsernameGame = get("username_game")
+	report.Currency = get("currency")
+	report.BrandID = get("brand_id")
+	report.BrandName = get("brand_name")
+	report.GameID = get("game_id")
+	report.GameName = get("game_name")
+	report.GameType = get("game_type")
+	report.TransactionID = get("transaction_id")
+	report.RoundID = get("round_id")
+	report.Status = domain.ReportStatus(get("status"))
+
+	if report.Winloss, err = strconv.ParseInt(get("winloss"), 10, 64); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid winloss: %w", err)
+	}
+	if report.Bet, err = strconv.ParseInt(get("bet"), 10, 64); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid bet: %w", err)
+	}
+	if report.Turnover, err = strconv.ParseInt(get("turnover"), 10, 64); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid turnover: %w", err)
+	}
+	if report.Payout, err = strconv.ParseFloat(get("payout"), 64); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid payout: %w", err)
+	}
+	if report.BetTime, err = time.Parse(time.RFC3339Nano, get("bet_time")); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid bet_time: %w", err)
+	}
+	if version := get("version"); version != "" {
+		v, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			return domain.Report{}, fmt.Errorf("invalid version: %w", err)
+		}
+		report.Version = uint32(v)
+	}
+	report = report.WithDefaults()
+
+	if err := report.Validate(); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid report: %w", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,251 @@
+package dataset
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is the on-disk encoding of a dataset, picked from the file extension:
+// .ndjson, .csv or .parquet. NDJSON and CSV can additionally end in .gz or .zst.
+type Format string
+
+const (
+	NDJSON  Format = "ndjson"
+	CSV     Format = "csv"
+	Parquet Format = "parquet"
+)
+
+type Compression string
+
+const (
+	None Compression = ""
+	Gzip Compression = "gz"
+	Zstd Compression = "zst"
+)
+
+// Writer appends reports to a dataset file. Close must be called to flush it.
+type Writer interface {
+	Write(reports []domain.Report) error
+	Close() error
+}
+
+// Reader reads reports back in chunks. Read returns io.EOF once the dataset is exhausted.
+type Reader interface {
+	Read(n int) ([]domain.Report, error)
+	Close() error
+}
+
+func ParsePath(path string) (Format, Compression, error) {
+	name := strings.ToLower(path)
+
+	compression := None
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		compression = Gzip
+		name = strings.TrimSuffix(name, ".gz")
+	case strings.HasSuffix(name, ".zst"):
+		compression = Zstd
+		name = strings.TrimSuffix(name, ".zst")
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"):
+		return NDJSON, compression, nil
+	case strings.HasSuffix(name, ".csv"):
+		return CSV, compression, nil
+	case strings.HasSuffix(name, ".parquet"):
+		if compression != None {
+			return "", "", fmt.Errorf("%s: parquet files are compressed internally", path)
+		}
+		return Parquet, None, nil
+	}
+
+	return "", "", fmt.Errorf("%s: unknown dataset format", path)
+}
+
+// Create creates a dataset file, the format and compression follow the file extension.
+func Create(path string) (Writer, error) {
+	format, compression, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create dataset error: %w", err)
+	}
+
+	if format == Parquet {
+		return newParquetWriter(f), nil
+	}
+
+	w, err := compress(f, compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if format == CSV {
+		return newCSVWriter(w)
+	}
+	return newNDJSONWriter(w), nil
+}
+
+// Open opens a dataset file and validates its schema before any report is read.
+func Open(path string) (Reader, error) {
+	format, compression, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open dataset error: %w", err)
+	}
+
+	if format == Parquet {
+		r, err := newParquetReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+
+	rc, err := decompress(f, compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if format == CSV {
+		r, err := newCSVReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+	return newNDJSONReader(rc), nil
+}
+
+// Export writes every batch to path and returns how many reports were written.
+func Export(path string, batches <-chan []domain.Report) (int, error) {
+	w, err := Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for batch := range batches {
+		if err := w.Write(batch); err != nil {
+			w.Close()
+			return written, err
+		}
+		written += len(batch)
+	}
+
+	return written, w.Close()
+}
+
+// Batches streams the reader in chunks of batchSize and closes it when done.
+// The error channel receives at most one error and is closed after the batches.
+func Batches(ctx context.Context, r Reader, batchSize int) (<-chan []domain.Report, <-chan error) {
+	out := make(chan []domain.Report, 1)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(out)
+		defer r.Close()
+
+		for {
+			batch, err := r.Read(batchSize)
+			if len(batch) > 0 {
+				select {
+				case out <- batch:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	return out, errs
+}
+
+// writeCloser closes the compressor before the file underneath it.
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *writeCloser) Close() error {
+	var errs []error
+	for _, c := range w.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func compress(f *os.File, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case Gzip:
+		gz := gzip.NewWriter(f)
+		return &writeCloser{gz, []io.Closer{gz, f}}, nil
+	case Zstd:
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			return nil, fmt.Errorf("zstd writer error: %w", err)
+		}
+		return &writeCloser{zw, []io.Closer{zw, f}}, nil
+	}
+	return f, nil
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func decompress(f *os.File, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case Gzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("gzip reader error: %w", err)
+		}
+		return &readCloser{gz, []io.Closer{gz, f}}, nil
+	case Zstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("zstd reader error: %w", err)
+		}
+		return &readCloser{zr, []io.Closer{zr.IOReadCloser(), f}}, nil
+	}
+	return f, nil
+}
@@ -0,0 +1,100 @@
+package dataset
+
+import (
+	"errors"
+	"hexgonaldb/internal/domain"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func sampleReports() []domain.Report {
+	betTime := time.Date(2024, time.May, 1, 10, 0, 0, 123456789, time.UTC)
+	report := domain.Report{
+		Username:      "player",
+		UsernameGame:  "player_slots",
+		Currency:      "USD",
+		Winloss:       -250,
+		Bet:           1000,
+		Turnover:      1000,
+		Payout:        0.75,
+		BetTime:       betTime,
+		BrandID:       "brand",
+		BrandName:     "Brand, \"quoted\"",
+		GameID:        "game",
+		GameName:      "Game\nwith a newline",
+		GameType:      "slot",
+		TransactionID: "tx1",
+		RoundID:       "round1",
+		Status:        domain.Settled,
+		Version:       1,
+	}
+
+	void := report
+	void.TransactionID, void.Status, void.Version = "tx2", domain.Void, 2
+
+	resettled := report
+	resettled.TransactionID, resettled.Status, resettled.Version = "tx3", domain.Resettled, 7
+	resettled.Winloss, resettled.Payout = 500, 1.5
+	resettled.BetTime = betTime.Add(time.Hour)
+
+	return []domain.Report{report, void, resettled}
+}
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"reports.ndjson",
+		"reports.ndjson.gz",
+		"reports.csv",
+		"reports.csv.zst",
+		"reports.parquet",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			want := sampleReports()
+
+			w, err := Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(want[:2]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(want[2:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			var got []domain.Report
+			for {
+				batch, err := r.Read(2)
+				got = append(got, batch...)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("read %d reports, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(got[i], want[i]) {
+					t.Errorf("report %d changed:\ngot  %+v\nwant %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"io"
+)
+
+type ndjsonWriter struct {
+	w   io.WriteCloser
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.WriteCloser) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{w: w, buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (w *ndjsonWriter) Write(reports []domain.Report) error {
+	for i := range reports {
+		if err := w.enc.Encode(&reports[i]); err != nil {
+			return fmt.Errorf("ndjson encode error: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *ndjsonWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.w.Close()
+		return fmt.Errorf("ndjson flush error: %w", err)
+	}
+	return w.w.Close()
+}
+
+type ndjsonReader struct {
+	rc      io.ReadCloser
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONReader(rc io.ReadCloser) *ndjsonReader {
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ndjsonReader{rc: rc, scanner: scanner}
+}
+
+func (r *ndjsonReader) Read(n int) ([]domain.Report, error) {
+	reports := make([]domain.Report, 0, n)
+
+	for len(reports) < n {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return reports, fmt.Errorf("ndjson read error at line %d: %w", r.line+1, err)
+			}
+			return reports, io.EOF
+		}
+		r.line++
+
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		report, err := DecodeNDJSONLine(line)
+		if err != nil {
+			return reports, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (r *ndjsonReader) Close() error {
+	return r.rc.Close()
+}
+
+// DecodeNDJSONLine decodes and validates a single report, rejecting unknown fields.
+func DecodeNDJSONLine(line []byte) (domain.Report, error) {
+	var report domain.Report
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&report); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid report: %w", err)
+	}
+	if err := report.Validate(); err != nil {
+		return domain.Report{}, fmt.Errorf("invalid report: %w", err)
+	}
+
+	return report, nil
+}
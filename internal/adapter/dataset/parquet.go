@@ -0,0 +1,183 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"io"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+const parquetRowGroupSize = 128 * 1024
+
+// parquetReport is the parquet row layout, bet_time is stored as nanoseconds since epoch.
+// Files written before corrections existed lack status and version, their reports are
+// settled, version 1.
+type parquetReport struct {
+	Username      string  `parquet:"username,dict"`
+	UsernameGame  string  `parquet:"username_game"`
+	Currency      string  `parquet:"currency,dict"`
+	Winloss       int64   `parquet:"winloss"`
+	Bet           int64   `parquet:"bet"`
+	Turnover      int64   `parquet:"turnover"`
+	Payout        float64 `parquet:"payout"`
+	BetTime       int64   `parquet:"bet_time,timestamp(nanosecond)"`
+	BrandID       string  `parquet:"brand_id,dict"`
+	BrandName     string  `parquet:"brand_name,dict"`
+	GameID        string  `parquet:"game_id,dict"`
+	GameName      string  `parquet:"game_name,dict"`
+	GameType      string  `parquet:"game_type,dict"`
+	TransactionID string  `parquet:"transaction_id"`
+	RoundID       string  `parquet:"round_id"`
+	Status        string  `parquet:"status,dict"`
+	Version       uint32  `parquet:"version"`
+}
+
+var parquetOptional = map[string]bool{"status": true, "version": true}
+
+var parquetSchema = parquet.SchemaOf(parquetReport{})
+
+type parquetWriter struct {
+	f    *os.File
+	w    *parquet.GenericWriter[parquetReport]
+	rows []parquetReport
+}
+
+func newParquetWriter(f *os.File) *parquetWriter {
+	w := parquet.NewGenericWriter[parquetReport](f,
+		parquet.Compression(&zstd.Codec{}),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+	)
+	return &parquetWriter{f: f, w: w}
+}
+
+func (w *parquetWriter) Write(reports []domain.Report) error {
+	w.rows = w.rows[:0]
+	for _, r := range reports {
+		w.rows = append(w.rows, parquetReport{
+			Username:      r.Username,
+			UsernameGame:  r.UsernameGame,
+			Currency:      r.Currency,
+			Winloss:       r.Winloss,
+			Bet:           r.Bet,
+			Turnover:      r.Turnover,
+			Payout:        r.Payout,
+			BetTime:       r.BetTime.UnixNano(),
+			BrandID:       r.BrandID,
+			BrandName:     r.BrandName,
+			GameID:        r.GameID,
+			GameName:      r.GameName,
+			GameType:      r.GameType,
+			TransactionID: r.TransactionID,
+			RoundID:       r.RoundID,
+			Status:        string(r.Status),
+			Version:       r.Version,
+		})
+	}
+
+	if _, err := w.w.Write(w.rows); err != nil {
+		return fmt.Errorf("parquet write error: %w", err)
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.w.Close(); err != nil {
+		w.f.Close()
+		return fmt.Errorf("parquet close error: %w", err)
+	}
+	return w.f.Close()
+}
+
+type parquetReader struct {
+	f    *os.File
+	r    *parquet.GenericReader[parquetReport]
+	rows []parquetReport
+}
+
+func newParquetReader(f *os.File) (*parquetReader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("parquet stat error: %w", err)
+	}
+
+	file, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		return nil, fmt.Errorf("parquet open error: %w", err)
+	}
+
+	if err := validateParquetSchema(file.Schema()); err != nil {
+		return nil, err
+	}
+
+	return &parquetReader{f: f, r: parquet.NewGenericReader[parquetReport](file)}, nil
+}
+
+func (r *parquetReader) Read(n int) ([]domain.Report, error) {
+	if cap(r.rows) < n {
+		r.rows = make([]parquetReport, n)
+	}
+	rows := r.rows[:n]
+
+	read, err := r.r.Read(rows)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parquet read error: %w", err)
+	}
+
+	reports := make([]domain.Report, 0, read)
+	for _, row := range rows[:read] {
+		report := domain.Report{
+			Username:      row.Username,
+			UsernameGame:  row.UsernameGame,
+			Currency:      row.Currency,
+			Winloss:       row.Winloss,
+			Bet:           row.Bet,
+			Turnover:      row.Turnover,
+			Payout:        row.Payout,
+			BetTime:       time.Unix(0, row.BetTime).UTC(),
+			BrandID:       row.BrandID,
+			BrandName:     row.BrandName,
+			GameID:        row.GameID,
+			GameName:      row.GameName,
+			GameType:      row.GameType,
+			TransactionID: row.TransactionID,
+			RoundID:       row.RoundID,
+			Status:        domain.ReportStatus(row.Status),
+			Version:       row.Version,
+		}.WithDefaults()
+		if verr := report.Validate(); verr != nil {
+			return reports, fmt.Errorf("row %d: invalid report: %w", len(reports), verr)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, err
+}
+
+func (r *parquetReader) Close() error {
+	r.r.Close()
+	return r.f.Close()
+}
+
+// validateParquetSchema requires every report column with the same physical type, the
+// optional ones only when present.
+func validateParquetSchema(schema *parquet.Schema) error {
+	for _, path := range parquetSchema.Columns() {
+		want, _ := parquetSchema.Lookup(path...)
+		got, ok := schema.Lookup(path...)
+		if !ok && parquetOptional[path[0]] {
+			continue
+		}
+		if !ok {
+			return fmt.Errorf("parquet schema error: missing column %q", path[0])
+		}
+		if got.Node.Type().Kind() != want.Node.Type().Kind() {
+			return fmt.Errorf("parquet schema error: column %q is %s, want %s", path[0], got.Node.Type().Kind(), want.Node.Type().Kind())
+		}
+	}
+	return nil
+}
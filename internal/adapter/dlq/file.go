@@ -0,0 +1,236 @@
+package dlq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore appends dead letters to a local NDJSON file, one batch per line. Failures are
+// rare, so every Put opens, writes and syncs the file; nothing is lost on a crash right after.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+func (s *FileStore) Put(letter domain.DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("dead letter encode error: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("dead letter dir error: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("dead letter open error: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("dead letter write error: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("dead letter sync error: %w", err)
+	}
+	return f.Close()
+}
+
+// Lock keeps Replay of this file from starting, in any process, until unlock is called,
+// and waits for a running one to finish. A replay holds letters in memory, so deleting
+// from the file under it wouldn't stop them from being written again.
+func (s *FileStore) Lock() (unlock func(), err error) {
+	return lockFile(s.path + ".lock")
+}
+
+// DeletePlayerData removes the reports of username from every kept batch, dropping batches
+// left empty, in the file and in replays that stopped halfway. Each file is rewritten
+// through a rename, so a crash leaves either the old or the new one.
+func (s *FileStore) DeletePlayerData(username string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leftovers, err := filepath.Glob(s.path + ".replaying-*")
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, path := range append([]string{s.path}, leftovers...) {
+		n, err := deletePlayerData(path, username)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+func deletePlayerData(path, username string) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("dead letter open error: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		removed int64
+		kept    bytes.Buffer
+	)
+	reader := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("%s line %d: %w", path, lineNo, err)
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var letter domain.DeadLetter
+			if err := json.Unmarshal(trimmed, &letter); err != nil {
+				return 0, fmt.Errorf("%s line %d: %w", path, lineNo, err)
+			}
+
+			reports := letter.Reports[:0]
+			for _, report := range letter.Reports {
+				if report.Username != username {
+					reports = append(reports, report)
+				}
+			}
+			if len(reports) == len(letter.Reports) {
+				kept.Write(trimmed)
+				kept.WriteByte('\n')
+			} else {
+				removed += int64(len(letter.Reports) - len(reports))
+				if len(reports) > 0 {
+					letter.Reports = reports
+					encoded, err := json.Marshal(letter)
+					if err != nil {
+						return 0, fmt.Errorf("dead letter encode error: %w", err)
+					}
+					kept.Write(encoded)
+					kept.WriteByte('\n')
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	f.Close()
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("dead letter rewrite error: %w", err)
+	}
+	if _, err := out.Write(kept.Bytes()); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("dead letter rewrite error: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("dead letter sync error: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return 0, fmt.Errorf("dead letter rewrite error: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("dead letter rewrite error: %w", err)
+	}
+	return removed, nil
+}
+
+// ReplayStats counts what Replay did with the letters of a file.
+type ReplayStats struct {
+	Letters int
+	Reports int
+	Failed  int // letters resubmit rejected again
+}
+
+// Replay moves the dead-letter file aside and hands every letter in it to resubmit, so
+// letters failing again while replaying land in a fresh file at path. The moved file is
+// deleted once every letter was handed over; if reading stops halfway it stays behind,
+// named path.replaying-<unix time>, and can be replayed by moving it back. It returns
+// os.ErrNotExist when there is nothing to replay. It holds the lock of FileStore.Lock
+// throughout, player data deletions wait for it.
+func Replay(path string, resubmit func(domain.DeadLetter) error) (ReplayStats, error) {
+	var stats ReplayStats
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return stats, err
+	}
+	defer unlock()
+
+	replaying := fmt.Sprintf("%s.replaying-%d", path, time.Now().Unix())
+	if err := os.Rename(path, replaying); err != nil {
+		return stats, err
+	}
+
+	f, err := os.Open(replaying)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	// letters can be whole batches of several MB, longer than a bufio.Scanner line
+	reader := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return stats, fmt.Errorf("%s line %d: %w", replaying, lineNo, err)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var letter domain.DeadLetter
+			if err := json.Unmarshal(line, &letter); err != nil {
+				return stats, fmt.Errorf("%s line %d: %w", replaying, lineNo, err)
+			}
+
+			stats.Letters++
+			stats.Reports += len(letter.Reports)
+			if err := resubmit(letter); err != nil {
+				stats.Failed++
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	f.Close()
+	return stats, os.Remove(replaying)
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package dlq
+
+import "sync"
+
+var fileLocks sync.Map // path to *sync.Mutex
+
+// lockFile only excludes holders within this process, there's no flock here.
+func lockFile(path string) (func(), error) {
+	mu, _ := fileLocks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock, nil
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"errors"
+	"hexgonaldb/internal/app/service"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /benchmarks
+func (h *handler) submitBenchmark(c *gin.Context) {
+	var scenario service.Scenario
+	if err := c.ShouldBindJSON(&scenario); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.benchmarks.Submit(scenario)
+	if errors.Is(err, service.ErrBenchmarkRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/benchmarks/"+job.ID)
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// GET /benchmarks/:id
+func (h *handler) getBenchmark(c *gin.Context) {
+	job, err := h.benchmarks.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job.Snapshot())
+}
+
+// DELETE /benchmarks/:id
+func (h *handler) cancelBenchmark(c *gin.Context) {
+	job, err := h.benchmarks.Cancel(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// GET /benchmarks/:id/events
+//
+// Server-Sent Events: everything published so far is replayed, then progress is streamed
+// until the job finishes or the client goes away.
+func (h *handler) streamBenchmark(c *gin.Context) {
+	job, err := h.benchmarks.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	for _, ev := range history {
+		c.SSEvent(ev.Type, ev)
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(ev.Type, ev)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
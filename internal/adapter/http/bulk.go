@@ -0,0 +1,176 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hexgonaldb/internal/adapter/dataset"
+	"hexgonaldb/internal/app/service"
+	"hexgonaldb/internal/domain"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bulkBatchSize  = 5000        // reports handed to the backends at once
+	maxLineSize    = 1024 * 1024 // longest NDJSON line accepted
+	maxRejectsKept = 1000        // rejected lines listed in the response, the rest are only counted
+)
+
+type rejectedLine struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type bulkResponse struct {
+	Lines            int            `json:"lines"`
+	Parsed           int            `json:"parsed"` // lines decoded and handed to the backends, Backends says what they wrote
+	Rejected         int            `json:"rejected"`
+	Rejects          []rejectedLine `json:"rejects"`
+	RejectsTruncated bool           `json:"rejects_truncated"`
+	Backends         []bulkBackend  `json:"backends"`
+	Error            string         `json:"error,omitempty"`
+}
+
+// bulkBackend sums the writes of an upload to one backend. Every parsed row ends up in
+// Rows, Duplicates, Unattributed, DeadLettered or Failed.
+type bulkBackend struct {
+	Backend         string  `json:"backend"`
+	Success         bool    `json:"success"` // every batch was written
+	Rows            int     `json:"rows"`
+	Duplicates      int     `json:"duplicates"`
+	DuplicatesScope string  `json:"duplicates_scope"`
+	Unattributed    int     `json:"unattributed,omitempty"`
+	DeadLettered    int     `json:"dead_lettered"` // rows of failed batches kept in the dead-letter store
+	Failed          int     `json:"failed"`        // rows of failed batches that weren't kept
+	TookMs          float64 `json:"took_ms"`
+	Error           string  `json:"error,omitempty"` // of the first failed batch
+}
+
+// POST /reports/ndjson
+//
+// The body is read line by line and written in batches of bulkBatchSize, so memory
+// doesn't grow with the size of the upload. Send Content-Encoding: gzip for compressed
+// bodies. Every line needs a transaction_id. Repeated ids, within the upload or stored by
+// an earlier one, are skipped by the backends and counted in their duplicates.
+func (h *handler) createReportsNDJSON(c *gin.Context) {
+	body := io.Reader(c.Request.Body)
+	if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid gzip body: " + err.Error()})
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var (
+		resp   = bulkResponse{Rejects: []rejectedLine{}}
+		totals = make(map[string]*bulkBackend)
+		batch  = make([]domain.Report, 0, bulkBatchSize)
+	)
+
+	reject := func(line int, err error) {
+		resp.Rejected++
+		if len(resp.Rejects) < maxRejectsKept {
+			resp.Rejects = append(resp.Rejects, rejectedLine{Line: line, Error: err.Error()})
+		} else {
+			resp.RejectsTruncated = true
+		}
+	}
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for _, result := range h.svc.WriteReports(c.Request.Context(), batch) {
+			total, ok := totals[result.Backend]
+			if !ok {
+				total = &bulkBackend{Backend: result.Backend, DuplicatesScope: result.DuplicatesScope, Success: true}
+				totals[result.Backend] = total
+			}
+			total.TookMs += float64(result.Took) / float64(time.Millisecond)
+
+			switch {
+			case result.Success:
+				total.Rows += result.Rows
+				total.Duplicates += result.Duplicates
+				total.Unattributed += result.Unattributed
+			case result.DeadLettered:
+				total.DeadLettered += len(batch)
+			default:
+				total.Failed += len(batch)
+			}
+			if !result.Success && total.Success {
+				total.Success = false
+				total.Error = result.Error
+			}
+		}
+		batch = make([]domain.Report, 0, bulkBatchSize)
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	for scanner.Scan() {
+		resp.Lines++
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		report, err := dataset.DecodeNDJSONLine(line)
+		if err != nil {
+			reject(resp.Lines, err)
+			continue
+		}
+
+		resp.Parsed++
+		batch = append(batch, report)
+		if len(batch) == bulkBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		resp.Error = fmt.Sprintf("reading body stopped at line %d: %v", resp.Lines+1, err)
+	}
+
+	for _, backend := range h.svc.Backends() {
+		if total, ok := totals[backend]; ok {
+			resp.Backends = append(resp.Backends, *total)
+		}
+	}
+
+	c.JSON(bulkStatus(resp), resp)
+}
+
+// bulkStatus is 200 once every backend wrote every parsed line, dead-lettered batches count as
+// failed like in writeStatus.
+func bulkStatus(resp bulkResponse) int {
+	switch {
+	case resp.Error != "":
+		return http.StatusBadRequest
+	case resp.Parsed == 0 && resp.Rejected > 0:
+		return http.StatusUnprocessableEntity
+	case resp.Parsed == 0:
+		return http.StatusOK
+	}
+
+	results := make([]service.BackendResult, 0, len(resp.Backends))
+	for _, backend := range resp.Backends {
+		results = append(results, service.BackendResult{Backend: backend.Backend, Success: backend.Success})
+	}
+	if status := writeStatus(results); status != http.StatusCreated {
+		return status
+	}
+	return http.StatusOK
+}
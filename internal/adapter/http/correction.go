@@ -0,0 +1,55 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app/service"
+	"hexgonaldb/internal/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /reports/corrections
+//
+// Takes a JSON array of corrections: the voided or resettled reports again, with a higher
+// version. Backends that already hold that version or a newer one count the correction as
+// a duplicate. Corrections whose bet_time differs from the stored report's are refused with
+// 400, 502 when the stored ones can't be read. Statuses are otherwise the same as for
+// POST /reports/batch.
+func (h *handler) correctReports(c *gin.Context) {
+	var corrections []domain.Report
+	if err := c.ShouldBindJSON(&corrections); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(corrections) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch is empty"})
+		return
+	}
+	if len(corrections) > maxBatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("batch has %d corrections, at most %d are allowed", len(corrections), maxBatchSize)})
+		return
+	}
+
+	results, err := h.svc.ApplyCorrections(c.Request.Context(), corrections)
+	var invalid service.InvalidCorrectionsError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid corrections", "invalid": invalid})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids := make([]string, len(corrections))
+	for i, correction := range corrections {
+		ids[i] = correction.TransactionID
+	}
+	c.JSON(writeStatus(results), ingestResponse{
+		TransactionIDs: ids,
+		Backends:       results,
+	})
+}
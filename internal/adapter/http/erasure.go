@@ -0,0 +1,55 @@
+package http
+
+import (
+	"errors"
+	"hexgonaldb/internal/app/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type erasureRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// POST /erasures
+//
+// Deletes every report of the player in the body from every backend and returns the audit
+// record. The username is sent in the body rather than the path so it stays out of access
+// logs. 200 when every backend deleted, 207 when only some did, 502 when none did.
+func (h *handler) erasePlayer(c *gin.Context) {
+	var req erasureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	erasure, err := h.svc.DeletePlayerData(req.Username)
+	if errors.Is(err, service.ErrNoErasureLog) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	failed := 0
+	for _, store := range erasure.Stores {
+		if store.Error != "" {
+			failed++
+		}
+	}
+
+	status := http.StatusOK
+	switch {
+	case failed > 0 && failed == len(erasure.Stores):
+		status = http.StatusBadGateway
+	case failed > 0:
+		status = http.StatusMultiStatus
+	case err != nil: // every store deleted but the audit record wasn't written
+		status = http.StatusInternalServerError
+	}
+
+	resp := gin.H{"erasure": erasure}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	c.JSON(status, resp)
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const pingTimeout = 2 * time.Second // per backend, for /readyz
+
+// GET /healthz
+//
+// Liveness only, it doesn't touch the backends.
+func (h *handler) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// GET /readyz
+//
+// Pings every configured backend, 503 when any of them doesn't answer in time.
+func (h *handler) readyz(c *gin.Context) {
+	statuses := h.svc.Ping(c.Request.Context(), pingTimeout)
+
+	status, code := "ready", http.StatusOK
+	for _, s := range statuses {
+		if !s.Ready {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{"status": status, "backends": statuses})
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type listResponse struct {
+	Backend    string          `json:"backend"`
+	TookMs     float64         `json:"took_ms"`
+	Reports    []domain.Report `json:"reports"`
+	NextCursor string          `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// cursorToken is the JSON inside a cursor. Clients only ever see it base64 encoded and
+// must not build or edit cursors themselves.
+type cursorToken struct {
+	BetTime       time.Time `json:"t"`
+	TransactionID string    `json:"id"`
+}
+
+func encodeCursor(cursor *domain.ReportCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	data, _ := json.Marshal(cursorToken{BetTime: cursor.BetTime, TransactionID: cursor.TransactionID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*domain.ReportCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil || token.BetTime.IsZero() {
+		return nil, errors.New("malformed cursor")
+	}
+	return &domain.ReportCursor{BetTime: token.BetTime, TransactionID: token.TransactionID}, nil
+}
+
+// GET /reports
+//
+// Lists raw reports in (bet_time, transaction_id) order, limit (default 100, at most 1000)
+// at a time. Pass next_cursor from the response as ?cursor= to get the next page, with
+// the same filters and backend.
+func (h *handler) listReports(c *gin.Context) {
+	backend := c.DefaultQuery("backend", defaultBackend)
+	f, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := defaultPageSize
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+			return
+		}
+	}
+
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	took, reports, next, err := h.svc.ListReports(backend, f, after, limit)
+	if err != nil {
+		queryError(c, backend, err)
+		return
+	}
+	if reports == nil {
+		reports = []domain.Report{}
+	}
+
+	c.JSON(http.StatusOK, listResponse{
+		Backend:    backend,
+		TookMs:     tookMs(took),
+		Reports:    reports,
+		NextCursor: encodeCursor(next),
+	})
+}
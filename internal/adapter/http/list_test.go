@@ -0,0 +1,57 @@
+package http
+
+import (
+	"encoding/base64"
+	"hexgonaldb/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []*domain.ReportCursor{
+		{BetTime: time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC), TransactionID: "tx1"},
+		{BetTime: time.Date(2024, time.May, 1, 10, 0, 0, 123456789, time.UTC), TransactionID: "tx/2+=?&"},
+		{BetTime: time.Date(2024, time.May, 1, 18, 0, 0, 0, time.FixedZone("UTC+8", 8*3600)), TransactionID: ""},
+	}
+
+	for _, cursor := range cursors {
+		encoded := encodeCursor(cursor)
+		decoded, err := decodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("%+v: %v", cursor, err)
+		}
+		if !decoded.BetTime.Equal(cursor.BetTime) || decoded.TransactionID != cursor.TransactionID {
+			t.Fatalf("got %+v back, want %+v", decoded, cursor)
+		}
+	}
+
+	if encodeCursor(nil) != "" {
+		t.Fatal("the last page has a cursor")
+	}
+	if cursor, err := decodeCursor(""); cursor != nil || err != nil {
+		t.Fatalf("no cursor decoded to %+v, %v", cursor, err)
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	valid := encodeCursor(&domain.ReportCursor{BetTime: time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC), TransactionID: "tx1"})
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	tests := map[string]string{
+		"not base64":        "not a cursor!",
+		"truncated":         valid[:len(valid)-4],
+		"not JSON":          encode("2024-05-01T10:00:00Z tx1"),
+		"no bet time":       encode(`{"id":"tx1"}`),
+		"zero bet time":     encode(`{"t":"0001-01-01T00:00:00Z","id":"tx1"}`),
+		"bet time a number": encode(`{"t":1714557600,"id":"tx1"}`),
+		"id a number":       encode(`{"t":"2024-05-01T10:00:00Z","id":1}`),
+	}
+
+	for name, cursor := range tests {
+		t.Run(name, func(t *testing.T) {
+			if decoded, err := decodeCursor(cursor); err == nil {
+				t.Fatalf("accepted %q as %+v", cursor, decoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /outbox
+//
+// Replication state of every outbox target: backlog, lag and delivery counters.
+func (h *handler) outboxStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"targets": h.relay.Status()})
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app/service"
+	"hexgonaldb/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultBackend = service.BackendClickHouse
+
+type queryResponse struct {
+	Backend string  `json:"backend"`
+	TookMs  float64 `json:"took_ms"`
+	Count   *int64  `json:"count,omitempty"`
+	Results any     `json:"results,omitempty"`
+}
+
+// parseFilter reads ?from=&to=&brand=&game=. Dates are RFC 3339 or YYYY-MM-DD, to is exclusive.
+func parseFilter(c *gin.Context) (domain.ReportFilter, error) {
+	var (
+		f   domain.ReportFilter
+		err error
+	)
+
+	if f.From, err = parseTime(c.Query("from")); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseTime(c.Query("to")); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, errors.New("from must be before to")
+	}
+	f.BrandID = c.Query("brand")
+	f.GameID = c.Query("game")
+
+	return f, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// queryError maps service errors to 400 for bad parameters and 502 for backend failures.
+func queryError(c *gin.Context, backend string, err error) {
+	status := http.StatusBadGateway
+	if errors.Is(err, service.ErrUnknownBackend) || errors.Is(err, service.ErrBackendNotConfigured) {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"backend": backend, "error": err.Error()})
+}
+
+func tookMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// GET /reports/count
+func (h *handler) countReports(c *gin.Context) {
+	backend := c.DefaultQuery("backend", defaultBackend)
+	f, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	took, count, err := h.svc.CountReports(backend, f)
+	if err != nil {
+		queryError(c, backend, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, queryResponse{Backend: backend, TookMs: tookMs(took), Count: &count})
+}
+
+// GET /reports/profit-by-game
+func (h *handler) profitByGame(c *gin.Context) {
+	backend := c.DefaultQuery("backend", defaultBackend)
+	f, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	took, results, err := h.svc.ProfitByGame(backend, f)
+	if err != nil {
+		queryError(c, backend, err)
+		return
+	}
+	if results == nil {
+		results = []domain.ProfitAggregationResult{}
+	}
+
+	c.JSON(http.StatusOK, queryResponse{Backend: backend, TookMs: tookMs(took), Results: results})
+}
+
+// GET /reports/rollup
+func (h *handler) rollup(c *gin.Context) {
+	backend := c.DefaultQuery("backend", defaultBackend)
+	f, err := parseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	granularity := domain.Granularity(c.DefaultQuery("granularity", string(domain.Day)))
+	if !granularity.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid granularity %q, use hour, day, week or month", granularity)})
+		return
+	}
+
+	took, results, err := h.svc.Rollup(backend, f, granularity)
+	if err != nil {
+		queryError(c, backend, err)
+		return
+	}
+	if results == nil {
+		results = []domain.SuperAggregationResult{}
+	}
+
+	c.JSON(http.StatusOK, queryResponse{Backend: backend, TookMs: tookMs(took), Results: results})
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"fmt"
+	"hexgonaldb/internal/app/service"
+	"hexgonaldb/internal/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBatchSize = 10_000
+
+type ingestResponse struct {
+	TransactionIDs []string                `json:"transaction_ids"`
+	Backends       []service.BackendResult `json:"backends"`
+}
+
+type invalidReport struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// POST /reports
+func (h *handler) createReport(c *gin.Context) {
+	var report domain.Report
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.ingest(c, []domain.Report{report})
+}
+
+// POST /reports/batch
+func (h *handler) createReports(c *gin.Context) {
+	var reports []domain.Report
+	if err := c.ShouldBindJSON(&reports); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(reports) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch is empty"})
+		return
+	}
+	if len(reports) > maxBatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("batch has %d reports, at most %d are allowed", len(reports), maxBatchSize)})
+		return
+	}
+
+	h.ingest(c, reports)
+}
+
+// ingest validates the whole batch up front, nothing is written unless every report is valid.
+// Reports need their own transaction_id: one assigned here would differ on every retry of
+// the request and store the report again.
+func (h *handler) ingest(c *gin.Context, reports []domain.Report) {
+	ids := make([]string, len(reports))
+	var invalid []invalidReport
+	for i, report := range reports {
+		ids[i] = report.TransactionID
+		if err := report.Validate(); err != nil {
+			invalid = append(invalid, invalidReport{Index: i, Error: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reports", "invalid": invalid})
+		return
+	}
+
+	results := h.svc.WriteReports(c.Request.Context(), reports)
+
+	c.JSON(writeStatus(results), ingestResponse{
+		TransactionIDs: ids,
+		Backends:       results,
+	})
+}
+
+// writeStatus is 201 when every backend stored the reports, 207 when only some did and 502 when none did.
+func writeStatus(results []service.BackendResult) int {
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+		}
+	}
+
+	switch {
+	case len(results) == 0:
+		return http.StatusServiceUnavailable
+	case failed == 0:
+		return http.StatusCreated
+	case failed < len(results):
+		return http.StatusMultiStatus
+	default:
+		return http.StatusBadGateway
+	}
+}
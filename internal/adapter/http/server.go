@@ -1,25 +1,137 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/adapter/metrics"
 	"hexgonaldb/internal/app/service"
-	"hexgonaldb/internal/domain"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RunServer(svc *service.Service) {
+type handler struct {
+	svc        *service.Service
+	benchmarks *service.Benchmarks
+	relay      *service.Relay
+}
+
+type ServerConfig struct {
+	Addr            string
+	ShutdownTimeout time.Duration
+	Metrics         *metrics.Metrics // served on /metrics, nil disables it
+	Relay           *service.Relay   // run in the background and served on /outbox, nil when the outbox is off
+}
+
+// RunServer serves until ctx is done, then shuts down within cfg.ShutdownTimeout: it stops
+// accepting connections, waits for in-flight requests, cancels the running benchmark, stops
+// the relay and closes the backend clients, unless something still runs after the timeout.
+// Outbox entries not delivered yet stay in Postgres for the next start.
+func RunServer(ctx context.Context, svc *service.Service, cfg ServerConfig) error {
 	r := gin.Default()
+	h := &handler{svc: svc, benchmarks: service.NewBenchmarks(svc), relay: cfg.Relay}
 
-	r.POST("/register", func(c *gin.Context) {
-		var report domain.Report
-		if err := c.ShouldBindJSON(&report); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+	if cfg.Metrics != nil {
+		r.Use(observeRequests(cfg.Metrics))
+		r.GET("/metrics", gin.WrapH(cfg.Metrics.Handler()))
+	}
+
+	r.GET("/healthz", h.healthz)
+	r.GET("/readyz", h.readyz)
+
+	r.POST("/reports", h.createReport)
+	r.POST("/reports/batch", h.createReports)
+	r.POST("/reports/ndjson", h.createReportsNDJSON)
+	r.POST("/reports/corrections", h.correctReports)
+
+	r.GET("/reports", h.listReports)
+	r.GET("/reports/count", h.countReports)
+	r.GET("/reports/profit-by-game", h.profitByGame)
+	r.GET("/reports/rollup", h.rollup)
+
+	r.POST("/erasures", h.erasePlayer)
+
+	r.POST("/benchmarks", h.submitBenchmark)
+	r.GET("/benchmarks/:id", h.getBenchmark)
+	r.DELETE("/benchmarks/:id", h.cancelBenchmark)
+	r.GET("/benchmarks/:id/events", h.streamBenchmark)
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	if cfg.Relay != nil {
+		r.GET("/outbox", h.outboxStatus)
+		go func() {
+			defer close(relayDone)
+			cfg.Relay.Run(relayCtx)
+		}()
+	} else {
+		close(relayDone)
+	}
+	defer stopRelay()
 
-		c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
-	})
+	srv := &http.Server{Addr: cfg.Addr, Handler: r}
 
-	r.Run(":8080")
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stopRelay()
+		<-relayDone
+		svc.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := h.benchmarks.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("benchmark shutdown error: %w", err))
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("server shutdown error: %w", err))
+	}
+
+	// after the server so requests still in flight get their outbox entries committed
+	stopRelay()
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		errs = append(errs, fmt.Errorf("relay shutdown error: %w", shutdownCtx.Err()))
+	}
+
+	// closing the clients under a request, benchmark or relay batch still running would fail
+	// it halfway, so they're left to the process exit instead
+	if len(errs) > 0 {
+		log.Printf("Shutdown timed out, leaving the backend clients open")
+		return errors.Join(errs...)
+	}
+	return svc.Close()
+}
+
+// observeRequests records every request except the scrapes themselves. Unmatched paths
+// share one route label so scanners can't create a series per path.
+func observeRequests(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "/metrics" {
+			return
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		m.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(startTime))
+	}
 }
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hexgonaldb"
+
+// Metrics holds every collector the service exposes on /metrics. It uses its own
+// registry so nothing registered globally by a dependency leaks into the output.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	opDuration   *prometheus.HistogramVec
+	opErrors     *prometheus.CounterVec
+	rowsInserted *prometheus.CounterVec
+	duplicates   *prometheus.CounterVec
+	rowsReturned *prometheus.CounterVec
+	inflight     *prometheus.GaugeVec
+
+	pools *poolCollector
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+
+		opDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_duration_seconds",
+			Help:      "Repository call latency by backend and operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 18), // 1ms to ~2m, aggregations over 15M rows are slow
+		}, []string{"backend", "operation"}),
+		opErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_errors_total",
+			Help:      "Failed repository calls by backend, operation and error type (timeout, canceled, network, other).",
+		}, []string{"backend", "operation", "type"}),
+		rowsInserted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_rows_inserted_total",
+			Help:      "Rows successfully written by backend.",
+		}, []string{"backend"}),
+		duplicates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_duplicates_dropped_total",
+			Help:      "Rows skipped by backend because their transaction_id was already stored.",
+		}, []string{"backend"}),
+		rowsReturned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_rows_returned_total",
+			Help:      "Result rows returned by queries by backend and operation.",
+		}, []string{"backend", "operation"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "repository_inflight_batches",
+			Help:      "Insert batches currently being written by backend.",
+		}, []string{"backend"}),
+
+		pools: newPoolCollector(),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration,
+		m.opDuration, m.opErrors, m.rowsInserted, m.duplicates, m.rowsReturned, m.inflight,
+		m.pools,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest records one finished HTTP request. route is the route pattern, not the
+// raw path, so ids in the path don't blow up the label cardinality.
+func (m *Metrics) ObserveRequest(method, route string, status int, took time.Duration) {
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(took.Seconds())
+}
+
+// observe records one repository call that returned rows result rows.
+func (m *Metrics) observe(backend, operation string, startTime time.Time, rows int, err error) {
+	m.opDuration.WithLabelValues(backend, operation).Observe(time.Since(startTime).Seconds())
+	if err != nil {
+		m.opErrors.WithLabelValues(backend, operation, errorType(err)).Inc()
+		return
+	}
+	m.rowsReturned.WithLabelValues(backend, operation).Add(float64(rows))
+}
+
+// insert tracks one write of rows rows, call the returned func with the rows actually
+// inserted and the error once it's done. Rows not inserted without an error were duplicates.
+func (m *Metrics) insert(backend, operation string, rows int) func(int64, error) {
+	startTime := time.Now()
+	m.inflight.WithLabelValues(backend).Inc()
+
+	return func(inserted int64, err error) {
+		m.inflight.WithLabelValues(backend).Dec()
+		m.opDuration.WithLabelValues(backend, operation).Observe(time.Since(startTime).Seconds())
+		if err != nil {
+			m.opErrors.WithLabelValues(backend, operation, errorType(err)).Inc()
+			return
+		}
+		m.rowsInserted.WithLabelValues(backend).Add(float64(inserted))
+		m.duplicates.WithLabelValues(backend).Add(float64(int64(rows) - inserted))
+	}
+}
+
+func errorType(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
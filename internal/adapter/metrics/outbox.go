@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"hexgonaldb/internal/app/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// relayCollector reads the relay status at scrape time.
+type relayCollector struct {
+	relay *service.Relay
+
+	backlog   *prometheus.Desc
+	lag       *prometheus.Desc
+	delivered *prometheus.Desc
+	rows      *prometheus.Desc
+	failures  *prometheus.Desc
+}
+
+// RegisterRelay exposes the replication backlog and lag of every outbox target.
+func (m *Metrics) RegisterRelay(relay *service.Relay) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "outbox", name), help, []string{"target"}, nil)
+	}
+
+	m.registry.MustRegister(&relayCollector{
+		relay:     relay,
+		backlog:   desc("backlog_entries", "Outbox entries not delivered to the target yet."),
+		lag:       desc("lag_seconds", "Age of the oldest outbox entry not delivered to the target yet."),
+		delivered: desc("delivered_entries_total", "Outbox entries delivered to the target."),
+		rows:      desc("delivered_rows_total", "Rows inserted into the target by the relay."),
+		failures:  desc("delivery_failures_total", "Failed delivery attempts to the target."),
+	})
+}
+
+func (c *relayCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.backlog
+	ch <- c.lag
+	ch <- c.delivered
+	ch <- c.rows
+	ch <- c.failures
+}
+
+func (c *relayCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.relay.Status() {
+		ch <- prometheus.MustNewConstMetric(c.backlog, prometheus.GaugeValue, float64(s.Backlog), s.Target)
+		ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, s.Lag.Seconds(), s.Target)
+		ch <- prometheus.MustNewConstMetric(c.delivered, prometheus.CounterValue, float64(s.Delivered), s.Target)
+		ch <- prometheus.MustNewConstMetric(c.rows, prometheus.CounterValue, float64(s.Rows), s.Target)
+		ch <- prometheus.MustNewConstMetric(c.failures, prometheus.CounterValue, float64(s.Failures), s.Target)
+	}
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// PoolStats is a point in time view of a backend connection pool.
+type PoolStats struct {
+	Open    int
+	InUse   int
+	Idle    int
+	MaxOpen int // 0 when unlimited
+}
+
+// poolCollector reads the pool of every registered backend at scrape time.
+type poolCollector struct {
+	connections *prometheus.Desc
+	maxOpen     *prometheus.Desc
+
+	mu      sync.Mutex
+	sources map[string]func() PoolStats
+}
+
+func newPoolCollector() *poolCollector {
+	return &poolCollector{
+		connections: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "repository", "pool_connections"),
+			"Connections in the backend pool by state (open, in_use, idle).",
+			[]string{"backend", "state"}, nil,
+		),
+		maxOpen: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "repository", "pool_max_connections"),
+			"Maximum connections the backend pool opens, 0 when unlimited.",
+			[]string{"backend"}, nil,
+		),
+		sources: make(map[string]func() PoolStats),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connections
+	ch <- c.maxOpen
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for backend, source := range c.sources {
+		stats := source()
+		ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.Open), backend, "open")
+		ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.InUse), backend, "in_use")
+		ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.Idle), backend, "idle")
+		ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpen), backend)
+	}
+}
+
+// RegisterPool exposes the pool stats of backend, source is called on every scrape.
+func (m *Metrics) RegisterPool(backend string, source func() PoolStats) {
+	m.pools.mu.Lock()
+	defer m.pools.mu.Unlock()
+	m.pools.sources[backend] = source
+}
+
+// MongoPoolMonitor returns a pool monitor that keeps the stats of backend up to date.
+// The Mongo driver has no pool stats call, so they're counted from pool events.
+func (m *Metrics) MongoPoolMonitor(backend string) *event.PoolMonitor {
+	var (
+		mu    sync.Mutex
+		stats PoolStats
+	)
+
+	m.RegisterPool(backend, func() PoolStats {
+		mu.Lock()
+		defer mu.Unlock()
+		s := stats
+		s.Idle = s.Open - s.InUse
+		return s
+	})
+
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch e.Type {
+			case event.PoolCreated:
+				if e.PoolOptions != nil {
+					stats.MaxOpen = int(e.PoolOptions.MaxPoolSize)
+				}
+			case event.ConnectionCreated:
+				stats.Open++
+			case event.ConnectionClosed:
+				stats.Open--
+			case event.GetSucceeded:
+				stats.InUse++
+			case event.ConnectionReturned:
+				stats.InUse--
+			}
+		},
+	}
+}
@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/app/service"
+	"hexgonaldb/internal/domain"
+	"time"
+)
+
+// The wrappers below decorate the repository ports, so every call the service makes is
+// measured without the adapters knowing about Prometheus. Wrapping nil returns nil, the
+// service treats a nil repository as a backend that isn't configured.
+
+type postgresRepository struct {
+	app.PostgresRepository
+	m *Metrics
+}
+
+func (m *Metrics) WrapPostgres(r app.PostgresRepository) app.PostgresRepository {
+	if r == nil {
+		return nil
+	}
+	return &postgresRepository{PostgresRepository: r, m: m}
+}
+
+func (r *postgresRepository) CreateReport(report domain.Report) error {
+	done := r.m.insert(service.BackendPostgres, "create_report", 1)
+	err := r.PostgresRepository.CreateReport(report)
+	done(1, err)
+	return err
+}
+
+func (r *postgresRepository) CreateManyReports(reports []domain.Report) (int64, error) {
+	done := r.m.insert(service.BackendPostgres, "create_many_reports", len(reports))
+	inserted, err := r.PostgresRepository.CreateManyReports(reports)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *postgresRepository) DeletePlayerData(username string) (int64, error) {
+	startTime := time.Now()
+	deleted, err := r.PostgresRepository.DeletePlayerData(username)
+	r.m.observe(service.BackendPostgres, "delete_player_data", startTime, 0, err)
+	return deleted, err
+}
+
+func (r *postgresRepository) BetTimes(transactionIDs []string) (map[string]time.Time, error) {
+	startTime := time.Now()
+	betTimes, err := r.PostgresRepository.BetTimes(transactionIDs)
+	r.m.observe(service.BackendPostgres, "bet_times", startTime, len(betTimes), err)
+	return betTimes, err
+}
+
+func (r *postgresRepository) CopyReports(reports []domain.Report) (int64, error) {
+	done := r.m.insert(service.BackendPostgres, "copy_reports", len(reports))
+	inserted, err := r.PostgresRepository.CopyReports(reports)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *postgresRepository) CopyReportsDirect(reports []domain.Report) (int64, error) {
+	done := r.m.insert(service.BackendPostgres, "copy_reports_direct", len(reports))
+	inserted, err := r.PostgresRepository.CopyReportsDirect(reports)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *postgresRepository) CreateReportsWithOutbox(reports []domain.Report, targets []string) (int64, error) {
+	done := r.m.insert(service.BackendPostgres, "create_reports_with_outbox", len(reports))
+	inserted, err := r.PostgresRepository.CreateReportsWithOutbox(reports, targets)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *postgresRepository) CountReports() (time.Duration, int64, error) {
+	startTime := time.Now()
+	took, count, err := r.PostgresRepository.CountReports()
+	r.m.observe(service.BackendPostgres, "count_reports", startTime, 1, err)
+	return took, count, err
+}
+
+func (r *postgresRepository) QueryReport() (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.PostgresRepository.QueryReport()
+	r.m.observe(service.BackendPostgres, "query_report", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *postgresRepository) CountReportsWhere(f domain.ReportFilter) (time.Duration, int64, error) {
+	startTime := time.Now()
+	took, count, err := r.PostgresRepository.CountReportsWhere(f)
+	r.m.observe(service.BackendPostgres, "count_reports_where", startTime, 1, err)
+	return took, count, err
+}
+
+func (r *postgresRepository) ProfitByGame(f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.PostgresRepository.ProfitByGame(f)
+	r.m.observe(service.BackendPostgres, "profit_by_game", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *postgresRepository) Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.PostgresRepository.Rollup(f, g)
+	r.m.observe(service.BackendPostgres, "rollup", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *postgresRepository) ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error) {
+	startTime := time.Now()
+	took, reports, err := r.PostgresRepository.ListReports(f, after, limit)
+	r.m.observe(service.BackendPostgres, "list_reports", startTime, len(reports), err)
+	return took, reports, err
+}
+
+type mongoRepository struct {
+	app.MongoRepository
+	m *Metrics
+}
+
+func (m *Metrics) WrapMongo(r app.MongoRepository) app.MongoRepository {
+	if r == nil {
+		return nil
+	}
+	return &mongoRepository{MongoRepository: r, m: m}
+}
+
+func (r *mongoRepository) CreateOneDocument(collection string, document interface{}) error {
+	done := r.m.insert(service.BackendMongo, "create_one_document", 1)
+	err := r.MongoRepository.CreateOneDocument(collection, document)
+	done(1, err)
+	return err
+}
+
+func (r *mongoRepository) CreateManyDocuments(collection string, documents []interface{}) (int64, error) {
+	done := r.m.insert(service.BackendMongo, "create_many_documents", len(documents))
+	inserted, err := r.MongoRepository.CreateManyDocuments(collection, documents)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *mongoRepository) InsertReports(collection string, reports []domain.Report, opts app.MongoWriteOptions) (int64, error) {
+	done := r.m.insert(service.BackendMongo, "insert_reports", len(reports))
+	inserted, err := r.MongoRepository.InsertReports(collection, reports, opts)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *mongoRepository) DeletePlayerData(collection string, username string) (int64, error) {
+	startTime := time.Now()
+	deleted, err := r.MongoRepository.DeletePlayerData(collection, username)
+	r.m.observe(service.BackendMongo, "delete_player_data", startTime, 0, err)
+	return deleted, err
+}
+
+func (r *mongoRepository) BetTimes(collection string, transactionIDs []string) (map[string]time.Time, error) {
+	startTime := time.Now()
+	betTimes, err := r.MongoRepository.BetTimes(collection, transactionIDs)
+	r.m.observe(service.BackendMongo, "bet_times", startTime, len(betTimes), err)
+	return betTimes, err
+}
+
+func (r *mongoRepository) CountDocuments(collection string, filter interface{}) (time.Duration, int64, error) {
+	startTime := time.Now()
+	took, count, err := r.MongoRepository.CountDocuments(collection, filter)
+	r.m.observe(service.BackendMongo, "count_documents", startTime, 1, err)
+	return took, count, err
+}
+
+func (r *mongoRepository) AggregationReports(collection string) (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.MongoRepository.AggregationReports(collection)
+	r.m.observe(service.BackendMongo, "aggregation_reports", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *mongoRepository) CountReportsWhere(collection string, f domain.ReportFilter) (time.Duration, int64, error) {
+	startTime := time.Now()
+	took, count, err := r.MongoRepository.CountReportsWhere(collection, f)
+	r.m.observe(service.BackendMongo, "count_reports_where", startTime, 1, err)
+	return took, count, err
+}
+
+func (r *mongoRepository) ProfitByGame(collection string, f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.MongoRepository.ProfitByGame(collection, f)
+	r.m.observe(service.BackendMongo, "profit_by_game", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *mongoRepository) Rollup(collection string, f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.MongoRepository.Rollup(collection, f, g)
+	r.m.observe(service.BackendMongo, "rollup", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *mongoRepository) ListReports(collection string, f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error) {
+	startTime := time.Now()
+	took, reports, err := r.MongoRepository.ListReports(collection, f, after, limit)
+	r.m.observe(service.BackendMongo, "list_reports", startTime, len(reports), err)
+	return took, reports, err
+}
+
+type clickhouseRepository struct {
+	app.ClickhouseRepository
+	m *Metrics
+}
+
+func (m *Metrics) WrapClickhouse(r app.ClickhouseRepository) app.ClickhouseRepository {
+	if r == nil {
+		return nil
+	}
+	return &clickhouseRepository{ClickhouseRepository: r, m: m}
+}
+
+func (r *clickhouseRepository) InsertManyReportBatch(reports []domain.Report) (int64, error) {
+	done := r.m.insert(service.BackendClickHouse, "insert_many_report_batch", len(reports))
+	inserted, err := r.ClickhouseRepository.InsertManyReportBatch(reports)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *clickhouseRepository) InsertReports(reports []domain.Report, opts app.ClickhouseWriteOptions) (int64, error) {
+	done := r.m.insert(service.BackendClickHouse, "insert_reports", len(reports))
+	inserted, err := r.ClickhouseRepository.InsertReports(reports, opts)
+	done(inserted, err)
+	return inserted, err
+}
+
+func (r *clickhouseRepository) DeletePlayerData(username string) (int64, error) {
+	startTime := time.Now()
+	deleted, err := r.ClickhouseRepository.DeletePlayerData(username)
+	r.m.observe(service.BackendClickHouse, "delete_player_data", startTime, 0, err)
+	return deleted, err
+}
+
+func (r *clickhouseRepository) BetTimes(transactionIDs []string) (map[string]time.Time, error) {
+	startTime := time.Now()
+	betTimes, err := r.ClickhouseRepository.BetTimes(transactionIDs)
+	r.m.observe(service.BackendClickHouse, "bet_times", startTime, len(betTimes), err)
+	return betTimes, err
+}
+
+func (r *clickhouseRepository) CountReports() (time.Duration, int64, error) {
+	startTime := time.Now()
+	took, count, err := r.ClickhouseRepository.CountReports()
+	r.m.observe(service.BackendClickHouse, "count_reports", startTime, 1, err)
+	return took, count, err
+}
+
+func (r *clickhouseRepository) QueryReport() (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.ClickhouseRepository.QueryReport()
+	r.m.observe(service.BackendClickHouse, "query_report", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *clickhouseRepository) CountReportsWhere(f domain.ReportFilter) (time.Duration, int64, error) {
+	startTime := time.Now()
+	took, count, err := r.ClickhouseRepository.CountReportsWhere(f)
+	r.m.observe(service.BackendClickHouse, "count_reports_where", startTime, 1, err)
+	return took, count, err
+}
+
+func (r *clickhouseRepository) ProfitByGame(f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.ClickhouseRepository.ProfitByGame(f)
+	r.m.observe(service.BackendClickHouse, "profit_by_game", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *clickhouseRepository) Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	startTime := time.Now()
+	took, results, err := r.ClickhouseRepository.Rollup(f, g)
+	r.m.observe(service.BackendClickHouse, "rollup", startTime, len(results), err)
+	return took, results, err
+}
+
+func (r *clickhouseRepository) ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error) {
+	startTime := time.Now()
+	took, reports, err := r.ClickhouseRepository.ListReports(f, after, limit)
+	r.m.observe(service.BackendClickHouse, "list_reports", startTime, len(reports), err)
+	return took, reports, err
+}
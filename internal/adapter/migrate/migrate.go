@@ -0,0 +1,261 @@
+// Package migrate applies numbered SQL migrations to a backend and keeps track of them in
+// a state table, so schema changes reach existing databases and a database whose applied
+// migrations differ from the build is refused.
+//
+// Migrations are pairs of files named NNNN_name.up.sql and NNNN_name.down.sql. Statements
+// are separated by semicolons, which mustn't appear inside a statement. An empty down file
+// means there is nothing to undo.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was changed")
+	ErrUnknownMigration = errors.New("applied migration unknown to this build")
+	ErrPending          = errors.New("migrations pending")
+)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       []string
+	Down     []string
+	Checksum string // SHA-256 of the up file
+}
+
+// Applied is a migration as recorded in the state table.
+type Applied struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Driver runs migrations against one backend. Apply and Revert run the statements and
+// update the state table, atomically where the backend allows it.
+type Driver interface {
+	EnsureStateTable(ctx context.Context) error
+	Applied(ctx context.Context) ([]Applied, error)
+	Apply(ctx context.Context, m Migration) error
+	Revert(ctx context.Context, m Migration) error
+}
+
+type Migrator struct {
+	backend    string
+	driver     Driver
+	migrations []Migration
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// New reads the migrations in the root of fsys.
+func New(backend string, driver Driver, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s migrations read error: %w", backend, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	hasDown := make(map[int]bool)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s migration read error: %w", backend, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%s migration %d has files named %s and %s", backend, version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+			m.Up = statements(string(content))
+		} else {
+			m.Down = statements(string(content))
+			hasDown[version] = true
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, m := range byVersion {
+		if m.Checksum == "" || !hasDown[version] {
+			return nil, fmt.Errorf("%s migration %04d_%s needs an up and a down file", backend, version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return &Migrator{backend: backend, driver: driver, migrations: migrations}, nil
+}
+
+// statements splits a migration file on semicolons, dropping comment-only statements.
+func statements(sql string) []string {
+	var stmts []string
+	for _, stmt := range strings.Split(sql, ";") {
+		var lines []string
+		for _, line := range strings.Split(stmt, "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			stmts = append(stmts, strings.TrimSpace(strings.Join(lines, "\n")))
+		}
+	}
+	return stmts
+}
+
+func (m *Migrator) Backend() string {
+	return m.backend
+}
+
+// State is one migration known to the build or the database.
+type State struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	Problem   error     `json:"-"` // ErrChecksumMismatch or ErrUnknownMigration
+}
+
+// Status lists every migration of the build and every migration applied, by version.
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	if err := m.driver.EnsureStateTable(ctx); err != nil {
+		return nil, fmt.Errorf("%s migration state error: %w", m.backend, err)
+	}
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s migration state error: %w", m.backend, err)
+	}
+
+	appliedByVersion := make(map[int]Applied, len(applied))
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+	}
+
+	var states []State
+	for _, migration := range m.migrations {
+		state := State{Version: migration.Version, Name: migration.Name}
+		if a, ok := appliedByVersion[migration.Version]; ok {
+			state.Applied, state.AppliedAt = true, a.AppliedAt
+			if a.Checksum != migration.Checksum || a.Name != migration.Name {
+				state.Problem = ErrChecksumMismatch
+			}
+			delete(appliedByVersion, migration.Version)
+		}
+		states = append(states, state)
+	}
+	for _, a := range appliedByVersion {
+		states = append(states, State{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Problem: ErrUnknownMigration})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+
+	return states, nil
+}
+
+// Check fails unless every applied migration is part of the build and unchanged. With
+// allowPending false, migrations not applied yet fail it too.
+func (m *Migrator) Check(ctx context.Context, allowPending bool) error {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	pending := 0
+	for _, state := range states {
+		switch {
+		case state.Problem != nil:
+			errs = append(errs, fmt.Errorf("%s migration %04d_%s: %w", m.backend, state.Version, state.Name, state.Problem))
+		case !state.Applied:
+			pending++
+		}
+	}
+	if pending > 0 && !allowPending {
+		errs = append(errs, fmt.Errorf("%s: %d %w", m.backend, pending, ErrPending))
+	}
+	return errors.Join(errs...)
+}
+
+// Up applies every pending migration in order, after checking the applied ones, and
+// returns the migrations applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.Check(ctx, true); err != nil {
+		return nil, err
+	}
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s migration state error: %w", m.backend, err)
+	}
+	done := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		done[a.Version] = true
+	}
+
+	var ran []Migration
+	for _, migration := range m.migrations {
+		if done[migration.Version] {
+			continue
+		}
+		if err := m.driver.Apply(ctx, migration); err != nil {
+			return ran, fmt.Errorf("%s migration %04d_%s error: %w", m.backend, migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.Check(ctx, true); err != nil {
+		return nil, err
+	}
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s migration state error: %w", m.backend, err)
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Version > applied[j].Version })
+
+	byVersion := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var reverted []Migration
+	for _, a := range applied {
+		if len(reverted) == steps {
+			break
+		}
+		migration := byVersion[a.Version] // Check made sure it exists
+		if err := m.driver.Revert(ctx, migration); err != nil {
+			return reverted, fmt.Errorf("%s migration %04d_%s revert error: %w", m.backend, migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
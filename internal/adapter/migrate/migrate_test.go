@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeDriver keeps the state table in memory and records the migrations it ran.
+type fakeDriver struct {
+	applied map[int]Applied
+	ran     []string
+}
+
+func newFakeDriver(applied ...Applied) *fakeDriver {
+	d := &fakeDriver{applied: make(map[int]Applied)}
+	for _, a := range applied {
+		d.applied[a.Version] = a
+	}
+	return d
+}
+
+func (d *fakeDriver) EnsureStateTable(ctx context.Context) error {
+	return nil
+}
+
+func (d *fakeDriver) Applied(ctx context.Context) ([]Applied, error) {
+	var applied []Applied
+	for _, a := range d.applied {
+		applied = append(applied, a)
+	}
+	return applied, nil
+}
+
+func (d *fakeDriver) Apply(ctx context.Context, m Migration) error {
+	d.applied[m.Version] = Applied{Version: m.Version, Name: m.Name, Checksum: m.Checksum, AppliedAt: time.Now()}
+	d.ran = append(d.ran, m.Up...)
+	return nil
+}
+
+func (d *fakeDriver) Revert(ctx context.Context, m Migration) error {
+	delete(d.applied, m.Version)
+	d.ran = append(d.ran, m.Down...)
+	return nil
+}
+
+func migrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"0001_create.down.sql": {Data: []byte("DROP TABLE a;")},
+		"0002_alter.up.sql":    {Data: []byte("ALTER TABLE a ADD b int;")},
+		"0002_alter.down.sql":  {Data: []byte("ALTER TABLE a DROP b;")},
+		"README.md":            {Data: []byte("not a migration")},
+	}
+}
+
+func newMigrator(t *testing.T, driver Driver) *Migrator {
+	t.Helper()
+	m, err := New("test", driver, migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{name: "empty"},
+		{name: "comments only", sql: "-- nothing to undo\n"},
+		{name: "single", sql: "DROP TABLE a;", want: []string{"DROP TABLE a"}},
+		{name: "no trailing semicolon", sql: "DROP TABLE a", want: []string{"DROP TABLE a"}},
+		{
+			name: "comments and blank lines dropped",
+			sql:  "-- why\nCREATE TABLE a (\n\tid int\n);\n\n  -- indented comment\nDROP TABLE b;\n",
+			want: []string{"CREATE TABLE a (\n\tid int\n)", "DROP TABLE b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPairsUpAndDown(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove string
+		add    fstest.MapFS
+	}{
+		{name: "missing down", remove: "0002_alter.down.sql"},
+		{name: "missing up", remove: "0002_alter.up.sql"},
+		{name: "names differ", remove: "0002_alter.down.sql", add: fstest.MapFS{"0002_other.down.sql": {}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := migrations()
+			delete(fsys, tt.remove)
+			for name, file := range tt.add {
+				fsys[name] = file
+			}
+			if _, err := New("test", newFakeDriver(), fsys); err == nil {
+				t.Fatal("unpaired migration was accepted")
+			}
+		})
+	}
+
+	fsys := migrations()
+	fsys["0003_noop.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	fsys["0003_noop.down.sql"] = &fstest.MapFile{}
+	m, err := New("test", newFakeDriver(), fsys)
+	if err != nil {
+		t.Fatalf("empty down file refused: %v", err)
+	}
+	if got := len(m.migrations); got != 3 {
+		t.Fatalf("got %d migrations, want 3", got)
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	driver := newFakeDriver()
+	m := newMigrator(t, driver)
+	ctx := context.Background()
+
+	if err := m.Check(ctx, false); !errors.Is(err, ErrPending) {
+		t.Fatalf("got %v, want ErrPending", err)
+	}
+
+	ran, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0].Version != 1 || ran[1].Version != 2 {
+		t.Fatalf("applied %+v, want 1 then 2", ran)
+	}
+	if err := m.Check(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := m.Up(ctx); err != nil || len(ran) != 0 {
+		t.Fatalf("second Up applied %+v, err %v", ran, err)
+	}
+
+	reverted, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("reverted %+v, want 2", reverted)
+	}
+
+	want := []string{"CREATE TABLE a (id int)", "ALTER TABLE a ADD b int", "ALTER TABLE a DROP b"}
+	if !reflect.DeepEqual(driver.ran, want) {
+		t.Fatalf("ran %q, want %q", driver.ran, want)
+	}
+}
+
+func TestRefusesChangedAndUnknownMigrations(t *testing.T) {
+	m := newMigrator(t, newFakeDriver())
+	first := m.migrations[0]
+
+	tests := []struct {
+		name    string
+		applied Applied
+		want    error
+	}{
+		{
+			name:    "checksum changed",
+			applied: Applied{Version: first.Version, Name: first.Name, Checksum: "edited"},
+			want:    ErrChecksumMismatch,
+		},
+		{
+			name:    "renamed",
+			applied: Applied{Version: first.Version, Name: "renamed", Checksum: first.Checksum},
+			want:    ErrChecksumMismatch,
+		},
+		{
+			name:    "unknown",
+			applied: Applied{Version: 9, Name: "newer_build", Checksum: "abc"},
+			want:    ErrUnknownMigration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := newFakeDriver(tt.applied)
+			m := newMigrator(t, driver)
+			ctx := context.Background()
+
+			if err := m.Check(ctx, true); !errors.Is(err, tt.want) {
+				t.Fatalf("Check got %v, want %v", err, tt.want)
+			}
+			if _, err := m.Up(ctx); !errors.Is(err, tt.want) {
+				t.Fatalf("Up got %v, want %v", err, tt.want)
+			}
+			if _, err := m.Down(ctx, 1); !errors.Is(err, tt.want) {
+				t.Fatalf("Down got %v, want %v", err, tt.want)
+			}
+			if len(driver.ran) != 0 {
+				t.Fatalf("ran %q on a refused database", driver.ran)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"hexgonaldb/internal/adapter/migrate"
+	"io/fs"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrator returns the migrator of the Postgres schema.
+func (r *Repository) Migrator() (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New("postgres", migrationDriver{r.db}, files)
+}
+
+// migrationDriver runs every migration in a transaction together with its state row, so a
+// failing migration leaves nothing behind.
+type migrationDriver struct {
+	db *gorm.DB
+}
+
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+func (d migrationDriver) EnsureStateTable(ctx context.Context) error {
+	return d.db.WithContext(ctx).Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)
+	`).Error
+}
+
+func (d migrationDriver) Applied(ctx context.Context) ([]migrate.Applied, error) {
+	var rows []schemaMigration
+	if err := d.db.WithContext(ctx).Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make([]migrate.Applied, len(rows))
+	for i, row := range rows {
+		applied[i] = migrate.Applied{Version: row.Version, Name: row.Name, Checksum: row.Checksum, AppliedAt: row.AppliedAt}
+	}
+	return applied, nil
+}
+
+func (d migrationDriver) Apply(ctx context.Context, m migrate.Migration) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := exec(tx, m.Up); err != nil {
+			return err
+		}
+		row := schemaMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum, AppliedAt: time.Now()}
+		if err := tx.Create(&row).Error; err != nil {
+			return fmt.Errorf("migration state error: %w", err)
+		}
+		return nil
+	})
+}
+
+func (d migrationDriver) Revert(ctx context.Context, m migrate.Migration) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := exec(tx, m.Down); err != nil {
+			return err
+		}
+		if err := tx.Delete(&schemaMigration{}, m.Version).Error; err != nil {
+			return fmt.Errorf("migration state error: %w", err)
+		}
+		return nil
+	})
+}
+
+func exec(tx *gorm.DB, statements []string) error {
+	for i, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+-- IF NOT EXISTS adopts tables created by GORM's AutoMigrate before migrations existed
+CREATE TABLE IF NOT EXISTS reports (
+	username text,
+	username_game text,
+	currency text,
+	winloss bigint,
+	bet bigint,
+	turnover bigint,
+	payout decimal,
+	bet_time timestamptz,
+	brand_id text,
+	brand_name text,
+	game_id text,
+	game_name text,
+	game_type text,
+	transaction_id text,
+	round_id text
+);
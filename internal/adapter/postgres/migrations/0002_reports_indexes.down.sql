@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reports_bet_time_transaction_id;
+DROP INDEX IF EXISTS idx_reports_transaction_id;
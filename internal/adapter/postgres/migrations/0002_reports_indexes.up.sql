@@ -0,0 +1,5 @@
+-- idempotent ingestion, fails when the table already holds duplicate transaction ids
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_transaction_id ON reports (transaction_id);
+
+-- keyset pagination seeks on this index
+CREATE INDEX IF NOT EXISTS idx_reports_bet_time_transaction_id ON reports (bet_time, transaction_id);
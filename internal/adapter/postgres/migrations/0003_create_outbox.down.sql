@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS report_outbox_pending;
+DROP TABLE IF EXISTS report_outbox;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS report_outbox (
+	id bigserial PRIMARY KEY,
+	payload jsonb NOT NULL,
+	created_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS report_outbox_pending (
+	target text,
+	entry_id bigint,
+	PRIMARY KEY (target, entry_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE reports
+	DROP COLUMN IF EXISTS version,
+	DROP COLUMN IF EXISTS status;
@@ -0,0 +1,4 @@
+-- corrections, rows stored before them are version 1 and settled
+ALTER TABLE reports
+	ADD COLUMN IF NOT EXISTS status text DEFAULT 'settled',
+	ADD COLUMN IF NOT EXISTS version bigint DEFAULT 1;
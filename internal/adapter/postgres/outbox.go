@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// outboxEntry holds one batch of reports as JSON. Every target that still has to receive
+// it has a row in report_outbox_pending, acknowledging a delivery deletes that row. Acks
+// per entry, rather than a high-water mark per target, can't skip an entry whose
+// transaction committed after a later id was already read.
+type outboxEntry struct {
+	ID        int64     `gorm:"primaryKey"`
+	Payload   []byte    `gorm:"type:jsonb;not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (outboxEntry) TableName() string { return "report_outbox" }
+
+type outboxPending struct {
+	Target  string `gorm:"primaryKey"`
+	EntryID int64  `gorm:"primaryKey"`
+}
+
+func (outboxPending) TableName() string { return "report_outbox_pending" }
+
+// CreateReportsWithOutbox inserts the reports like CreateManyReports and, in the same
+// transaction, an outbox entry pending for every target. Either both commit or neither.
+func (r *Repository) CreateReportsWithOutbox(reports []domain.Report, targets []string) (int64, error) {
+	var inserted int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		latest := latestVersions(reports)
+		result := tx.Clauses(upsertLatest).Create(&latest)
+		if result.Error != nil {
+			return result.Error
+		}
+		inserted = result.RowsAffected
+
+		if len(targets) == 0 {
+			return nil
+		}
+
+		// reports skipped as duplicates are queued too, the targets may never have had them
+		payload, err := json.Marshal(reports)
+		if err != nil {
+			return fmt.Errorf("outbox payload error: %w", err)
+		}
+		entry := outboxEntry{Payload: payload}
+		if err := tx.Create(&entry).Error; err != nil {
+			return fmt.Errorf("outbox entry error: %w", err)
+		}
+
+		pending := make([]outboxPending, len(targets))
+		for i, target := range targets {
+			pending[i] = outboxPending{Target: target, EntryID: entry.ID}
+		}
+		if err := tx.Create(&pending).Error; err != nil {
+			return fmt.Errorf("outbox pending error: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, nil
+}
+
+// ReadOutbox returns up to limit entries pending for target, oldest first.
+func (r *Repository) ReadOutbox(target string, limit int) ([]domain.OutboxEntry, error) {
+	var rows []outboxEntry
+	err := r.db.Raw(`
+		SELECT o.id, o.payload, o.created_at
+		FROM report_outbox_pending p
+		JOIN report_outbox o ON o.id = p.entry_id
+		WHERE p.target = ?
+		ORDER BY p.entry_id
+		LIMIT ?
+	`, target, limit).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("Postgres outbox read error: %w", err)
+	}
+
+	entries := make([]domain.OutboxEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = domain.OutboxEntry{ID: row.ID, CreatedAt: row.CreatedAt}
+		if err := json.Unmarshal(row.Payload, &entries[i].Reports); err != nil {
+			return nil, fmt.Errorf("outbox entry %d payload error: %w", row.ID, err)
+		}
+	}
+
+	return entries, nil
+}
+
+// AckOutbox marks the entry as delivered to target.
+func (r *Repository) AckOutbox(target string, entryID int64) error {
+	return r.db.Where("target = ? AND entry_id = ?", target, entryID).Delete(&outboxPending{}).Error
+}
+
+// OutboxBacklog returns how many entries are pending for target and when the oldest of
+// them was committed, the zero time when nothing is pending.
+func (r *Repository) OutboxBacklog(target string) (int64, time.Time, error) {
+	var (
+		count  int64
+		oldest sql.NullTime
+	)
+	err := r.db.Raw(`
+		SELECT COUNT(*), MIN(o.created_at)
+		FROM report_outbox_pending p
+		JOIN report_outbox o ON o.id = p.entry_id
+		WHERE p.target = ?
+	`, target).Row().Scan(&count, &oldest)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("Postgres outbox backlog error: %w", err)
+	}
+
+	return count, oldest.Time, nil
+}
+
+// PruneOutbox deletes the entries every target has acknowledged.
+func (r *Repository) PruneOutbox() (int64, error) {
+	result := r.db.Exec(`
+		DELETE FROM report_outbox o
+		WHERE NOT EXISTS (SELECT 1 FROM report_outbox_pending p WHERE p.entry_id = o.id)
+	`)
+	return result.RowsAffected, result.Error
+}
@@ -1,13 +1,19 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"hexgonaldb/internal/app/service"
 	"hexgonaldb/internal/domain"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -20,16 +26,96 @@ func NewPostgresRepository() *Repository {
 	db, _ := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
-	db.AutoMigrate(&domain.Report{}) // Auto migrate User
+	// the schema is kept by migrations, see Migrator
 	return &Repository{db}
 }
 
+func (r *Repository) Ping(ctx context.Context) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (r *Repository) Close() error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// DBStats returns the connection pool stats of the underlying sql.DB.
+func (r *Repository) DBStats() (sql.DBStats, error) {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+	return sqlDB.Stats(), nil
+}
+
+// IsRetryable tells transient Postgres failures from permanent ones. Connection
+// exceptions (class 08), transaction rollbacks such as deadlocks (40), insufficient
+// resources (53) and operator interventions like a restart (57) are worth retrying, bad
+// data and constraint violations never are.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) == 5 {
+		switch pgErr.Code[:2] {
+		case "08", "40", "53", "57":
+			return true
+		}
+		return false
+	}
+	return pgconn.SafeToRetry(err) || pgconn.Timeout(err) || service.IsTransient(err)
+}
+
+// upsertLatest turns an insert into INSERT ... ON CONFLICT (transaction_id) DO UPDATE, the
+// stored report is only replaced by a higher version. Same versions are skipped as duplicates.
+var upsertLatest = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "transaction_id"}},
+	DoUpdates: clause.AssignmentColumns(reportColumns),
+	Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "reports.version < excluded.version"}}},
+}
+
+// onConflictLatest is upsertLatest for raw SQL.
+var onConflictLatest = func() string {
+	sets := make([]string, len(reportColumns))
+	for i, column := range reportColumns {
+		sets[i] = column + " = EXCLUDED." + column
+	}
+	return "ON CONFLICT (transaction_id) DO UPDATE SET " + strings.Join(sets, ", ") + " WHERE reports.version < EXCLUDED.version"
+}()
+
+// latestVersions keeps the highest version of every transaction in the batch, in batch
+// order. ON CONFLICT DO UPDATE can't touch the same row twice in one statement.
+func latestVersions(reports []domain.Report) []domain.Report {
+	index := make(map[string]int, len(reports))
+	latest := make([]domain.Report, 0, len(reports))
+	for _, report := range reports {
+		i, seen := index[report.TransactionID]
+		switch {
+		case !seen:
+			index[report.TransactionID] = len(latest)
+			latest = append(latest, report)
+		case report.Version > latest[i].Version:
+			latest[i] = report
+		}
+	}
+	return latest
+}
+
 func (r *Repository) CreateReport(report domain.Report) error {
-	return r.db.Create(&report).Error
+	return r.db.Clauses(upsertLatest).Create(&report).Error
 }
 
-func (r *Repository) CreateManyReports(reports []domain.Report) error {
-	return r.db.Create(&reports).Error
+// CreateManyReports inserts the reports, or replaces stored ones by a higher version, and
+// returns how many were written. Transactions already stored in that version are skipped.
+func (r *Repository) CreateManyReports(reports []domain.Report) (int64, error) {
+	latest := latestVersions(reports)
+	result := r.db.Clauses(upsertLatest).Create(&latest)
+	return result.RowsAffected, result.Error
 }
 
 func (r *Repository) FindAllReports() (time.Duration, []domain.Report, error) {
@@ -52,6 +138,7 @@ func (r *Repository) QueryReport() (time.Duration, []domain.ProfitAggregationRes
 			game_name, 
 			SUM(winloss) AS total_profit
 		FROM reports
+		WHERE status <> 'void'
 		GROUP BY game_name
 		ORDER BY total_profit DESC
 	`).Scan(&pgResults).Error
@@ -72,7 +159,7 @@ func (r *Repository) QueryReport2() (time.Duration, []domain.SuperAggregationRes
 	var pgResults []domain.SuperAggregationResult
 	err := r.db.Raw(`
 		SELECT 
-    		TO_CHAR(bet_time, 'YYYY-MM-DD') AS date,
+    		TO_CHAR(bet_time AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS date,
     		brand_id,
     		game_name,
     		SUM(bet) AS total_bet,
@@ -81,6 +168,7 @@ func (r *Repository) QueryReport2() (time.Duration, []domain.SuperAggregationRes
     		COUNT(*) AS total_count,
     		SUM(CASE WHEN winloss > 0 THEN winloss ELSE 0 END) AS positive_win
 			FROM reports
+		WHERE status <> 'void'
 		GROUP BY date, brand_id, game_name
 		ORDER BY date, brand_id, game_name;
 	`).Scan(&pgResults).Error
@@ -99,6 +187,57 @@ func (r *Repository) ClearAll() error {
 	return r.db.Exec("TRUNCATE TABLE reports").Error
 }
 
+// BetTimes returns the bet time of every transaction id that is stored.
+func (r *Repository) BetTimes(transactionIDs []string) (map[string]time.Time, error) {
+	var rows []struct {
+		TransactionID string
+		BetTime       time.Time
+	}
+	err := r.db.Model(&domain.Report{}).Select("transaction_id, bet_time").Where("transaction_id IN ?", transactionIDs).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	betTimes := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		betTimes[row.TransactionID] = row.BetTime
+	}
+	return betTimes, nil
+}
+
+// DeletePlayerData deletes every report of username and strips them from outbox entries
+// not delivered yet, so the relay can't bring them back. Returns the reports deleted.
+func (r *Repository) DeletePlayerData(username string) (int64, error) {
+	var deleted int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("DELETE FROM reports WHERE username = ?", username)
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+
+		err := tx.Exec(`
+			UPDATE report_outbox
+			SET payload = (
+				SELECT COALESCE(jsonb_agg(e), '[]'::jsonb)
+				FROM jsonb_array_elements(payload) e
+				WHERE e->>'username' <> ?
+			)
+			WHERE payload @> jsonb_build_array(jsonb_build_object('username', ?::text))
+		`, username, username).Error
+		if err != nil {
+			return fmt.Errorf("outbox erase error: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
 func (r *Repository) CountReports() (time.Duration, int64, error) {
 
 	startTime := time.Now()
@@ -116,3 +255,146 @@ func (r *Repository) CountReports() (time.Duration, int64, error) {
 
 	return elapsedTime, count, nil
 }
+
+// reportWhere builds the WHERE clause for f, with ? placeholders for gorm.
+func reportWhere(f domain.ReportFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	if !f.From.IsZero() {
+		conds = append(conds, "bet_time >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "bet_time < ?")
+		args = append(args, f.To)
+	}
+	if f.BrandID != "" {
+		conds = append(conds, "brand_id = ?")
+		args = append(args, f.BrandID)
+	}
+	if f.GameID != "" {
+		conds = append(conds, "game_id = ?")
+		args = append(args, f.GameID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// settledWhere is reportWhere for aggregations, voided bets don't count.
+func settledWhere(f domain.ReportFilter) (string, []any) {
+	where, args := reportWhere(f)
+	if where == "" {
+		return "WHERE status <> 'void'", args
+	}
+	return where + " AND status <> 'void'", args
+}
+
+// bucketExpr buckets in UTC like the other backends, TO_CHAR of a timestamptz would use the
+// session time zone.
+func bucketExpr(g domain.Granularity) string {
+	switch g {
+	case domain.Hour:
+		return "TO_CHAR(bet_time AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00')"
+	case domain.Week:
+		return "TO_CHAR(DATE_TRUNC('week', bet_time AT TIME ZONE 'UTC'), 'YYYY-MM-DD')"
+	case domain.Month:
+		return "TO_CHAR(bet_time AT TIME ZONE 'UTC', 'YYYY-MM')"
+	default:
+		return "TO_CHAR(bet_time AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	}
+}
+
+func (r *Repository) CountReportsWhere(f domain.ReportFilter) (time.Duration, int64, error) {
+	startTime := time.Now()
+
+	where, args := reportWhere(f)
+	var count int64
+	err := r.db.Raw("SELECT COUNT(*) FROM reports "+where, args...).Scan(&count).Error
+	if err != nil {
+		return time.Since(startTime), 0, fmt.Errorf("Postgres query error: %w", err)
+	}
+
+	return time.Since(startTime), count, nil
+}
+
+func (r *Repository) ProfitByGame(f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error) {
+	startTime := time.Now()
+
+	where, args := settledWhere(f)
+	var pgResults []domain.ProfitAggregationResult
+	err := r.db.Raw(`
+		SELECT
+			game_name,
+			SUM(winloss) AS total_profit
+		FROM reports
+		`+where+`
+		GROUP BY game_name
+		ORDER BY total_profit DESC
+	`, args...).Scan(&pgResults).Error
+	if err != nil {
+		return time.Since(startTime), []domain.ProfitAggregationResult{}, fmt.Errorf("Postgres query error: %w", err)
+	}
+
+	return time.Since(startTime), pgResults, nil
+}
+
+// Rollup is QueryReport2 with a filter and a choice of time bucket.
+func (r *Repository) Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	startTime := time.Now()
+
+	where, args := settledWhere(f)
+	var pgResults []domain.SuperAggregationResult
+	err := r.db.Raw(`
+		SELECT
+			`+bucketExpr(g)+` AS date,
+			brand_id,
+			game_name,
+			SUM(bet) AS total_bet,
+			SUM(turnover) AS total_turnover,
+			AVG(payout) AS average_payout,
+			COUNT(*) AS total_count,
+			SUM(CASE WHEN winloss > 0 THEN winloss ELSE 0 END) AS positive_win,
+			SUM(winloss) AS total_winloss
+		FROM reports
+		`+where+`
+		GROUP BY date, brand_id, game_name
+		ORDER BY date, brand_id, game_name
+	`, args...).Scan(&pgResults).Error
+	if err != nil {
+		return time.Since(startTime), []domain.SuperAggregationResult{}, fmt.Errorf("Postgres query error: %w", err)
+	}
+
+	return time.Since(startTime), pgResults, nil
+}
+
+// ListReports returns up to limit reports after the cursor in (bet_time, transaction_id)
+// order. It seeks on the index instead of using OFFSET, so deep pages cost the same as the first.
+func (r *Repository) ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error) {
+	startTime := time.Now()
+
+	where, args := reportWhere(f)
+	if after != nil {
+		if where == "" {
+			where = "WHERE "
+		} else {
+			where += " AND "
+		}
+		where += "(bet_time, transaction_id) > (?, ?)"
+		args = append(args, after.BetTime, after.TransactionID)
+	}
+	args = append(args, limit)
+
+	var reports []domain.Report
+	err := r.db.Raw("SELECT * FROM reports "+where+" ORDER BY bet_time, transaction_id LIMIT ?", args...).Scan(&reports).Error
+	if err != nil {
+		return time.Since(startTime), nil, fmt.Errorf("Postgres query error: %w", err)
+	}
+
+	return time.Since(startTime), reports, nil
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"hexgonaldb/internal/domain"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLatestVersions(t *testing.T) {
+	report := func(id string, version uint32, status domain.ReportStatus) domain.Report {
+		return domain.Report{TransactionID: id, Version: version, Status: status}
+	}
+
+	tests := []struct {
+		name string
+		in   []domain.Report
+		want []domain.Report
+	}{
+		{
+			name: "distinct ids keep batch order",
+			in:   []domain.Report{report("b", 1, domain.Settled), report("a", 1, domain.Settled)},
+			want: []domain.Report{report("b", 1, domain.Settled), report("a", 1, domain.Settled)},
+		},
+		{
+			name: "higher version replaces in place",
+			in:   []domain.Report{report("a", 1, domain.Settled), report("b", 1, domain.Settled), report("a", 2, domain.Void)},
+			want: []domain.Report{report("a", 2, domain.Void), report("b", 1, domain.Settled)},
+		},
+		{
+			name: "lower version arriving later is dropped",
+			in:   []domain.Report{report("a", 3, domain.Resettled), report("a", 2, domain.Void)},
+			want: []domain.Report{report("a", 3, domain.Resettled)},
+		},
+		{
+			name: "same version keeps the first",
+			in:   []domain.Report{report("a", 2, domain.Void), report("a", 2, domain.Resettled)},
+			want: []domain.Report{report("a", 2, domain.Void)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestVersions(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnConflictLatest(t *testing.T) {
+	// a same or lower version must leave the stored row alone, so it counts as a duplicate
+	if !strings.HasSuffix(onConflictLatest, "WHERE reports.version < EXCLUDED.version") {
+		t.Fatalf("upsert doesn't guard on the version: %s", onConflictLatest)
+	}
+	for _, column := range reportColumns {
+		if !strings.Contains(onConflictLatest, column+" = EXCLUDED."+column) {
+			t.Errorf("upsert doesn't set %s", column)
+		}
+	}
+}
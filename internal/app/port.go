@@ -1,19 +1,98 @@
 package app
 
 import (
+	"context"
 	"hexgonaldb/internal/domain"
+	"time"
 )
 
 // Define interfaces that adapter must implement (Ports)
 
+// Lifecycle is implemented by every repository.
+type Lifecycle interface {
+	Ping(ctx context.Context) error
+	Close() error
+}
+
 type PostgresRepository interface {
+	Lifecycle
 	CreateReport(report domain.Report) error
+	CreateManyReports(reports []domain.Report) (int64, error)
+	CopyReports(reports []domain.Report) (int64, error)
+	CopyReportsDirect(reports []domain.Report) (int64, error)
+	CountReports() (time.Duration, int64, error)
+	QueryReport() (time.Duration, []domain.ProfitAggregationResult, error)
+	CountReportsWhere(f domain.ReportFilter) (time.Duration, int64, error)
+	ProfitByGame(f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error)
+	Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error)
+	ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error)
+	DeletePlayerData(username string) (int64, error)
+	BetTimes(transactionIDs []string) (map[string]time.Time, error)
+	Outbox
+}
+
+// Outbox is the Postgres side of the transactional outbox: reports are committed together
+// with an entry per target, the relay reads and acknowledges the entries of one target.
+type Outbox interface {
+	CreateReportsWithOutbox(reports []domain.Report, targets []string) (int64, error)
+	ReadOutbox(target string, limit int) ([]domain.OutboxEntry, error)
+	AckOutbox(target string, entryID int64) error
+	OutboxBacklog(target string) (int64, time.Time, error)
+	PruneOutbox() (int64, error)
 }
 
 type MongoRepository interface {
+	Lifecycle
 	CreateOneDocument(collection string, document interface{}) error
-	CreateManyDocuments(collection string, documents []interface{}) error
+	CreateManyDocuments(collection string, documents []interface{}) (int64, error)
+	InsertReports(collection string, reports []domain.Report, opts MongoWriteOptions) (int64, error)
+	CountDocuments(collection string, filter interface{}) (time.Duration, int64, error)
+	AggregationReports(collection string) (time.Duration, []domain.ProfitAggregationResult, error)
+	CountReportsWhere(collection string, f domain.ReportFilter) (time.Duration, int64, error)
+	ProfitByGame(collection string, f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error)
+	Rollup(collection string, f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error)
+	ListReports(collection string, f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error)
+	DeletePlayerData(collection string, username string) (int64, error)
+	BetTimes(collection string, transactionIDs []string) (map[string]time.Time, error)
+}
+
+// MongoWriteOptions trade insert speed against durability.
+type MongoWriteOptions struct {
+	Ordered          bool   `json:"ordered"`                     // insert in order and stop at the first error (duplicates are skipped and resumed after)
+	W                string `json:"w,omitempty"`                 // write concern w: a number or "majority", empty keeps the server default
+	Journal          bool   `json:"j,omitempty"`                 // wait for the on-disk journal
+	BypassValidation bool   `json:"bypass_validation,omitempty"` // skip the collection's schema validation
 }
 
 type ClickhouseRepository interface {
+	Lifecycle
+	InsertManyReportBatch(report []domain.Report) (int64, error)
+	InsertReports(reports []domain.Report, opts ClickhouseWriteOptions) (int64, error)
+	CountReports() (time.Duration, int64, error)
+	QueryReport() (time.Duration, []domain.ProfitAggregationResult, error)
+	CountReportsWhere(f domain.ReportFilter) (time.Duration, int64, error)
+	ProfitByGame(f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error)
+	Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error)
+	ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error)
+	DeletePlayerData(username string) (int64, error)
+	BetTimes(transactionIDs []string) (map[string]time.Time, error)
+}
+
+// ClickhouseWriteOptions pick how batches are sent to ClickHouse.
+type ClickhouseWriteOptions struct {
+	Append      string `json:"append,omitempty"`       // row (default) appends report by report, column appends a slice per column
+	AsyncInsert string `json:"async_insert,omitempty"` // empty inserts synchronously, wait or nowait buffer on the server with or without wait_for_async_insert
+	Compression string `json:"compression,omitempty"`  // lz4 (default), zstd or none
+}
+
+// DeadLetterStore keeps the batches that failed permanently.
+type DeadLetterStore interface {
+	Put(letter domain.DeadLetter) error
+	DeletePlayerData(username string) (int64, error) // reports removed from the kept batches
+	Lock() (unlock func(), err error)                // keeps replays of the kept batches out until unlock
+}
+
+// ErasureLog keeps the audit trail of player data deletions.
+type ErasureLog interface {
+	Put(erasure domain.Erasure) error
 }
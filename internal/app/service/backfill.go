@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// BackfillConfig describes copying the reports of one backend into another.
+type BackfillConfig struct {
+	Source        string
+	Target        string
+	Filter        domain.ReportFilter
+	ChunkSize     int    // reports read and written at a time, default 5000
+	RowsPerSecond int    // 0 copies as fast as the backends allow
+	Checkpoint    string // file the progress is kept in, empty always starts over
+}
+
+// BackfillCheckpoint is the progress of a backfill, saved after every chunk so an
+// interrupted run resumes after the last chunk written.
+type BackfillCheckpoint struct {
+	Source       string               `json:"source"`
+	Target       string               `json:"target"`
+	Filter       domain.ReportFilter  `json:"filter"`
+	After        *domain.ReportCursor `json:"after,omitempty"`
+	Rows         int64                `json:"rows"`
+	Inserted     int64                `json:"inserted"`
+	DeadLettered int64                `json:"dead_lettered"`
+	Done         bool                 `json:"done"`
+}
+
+// DayTotals are the count and sums of one day of reports in a backend.
+type DayTotals struct {
+	Count    uint64 `json:"count"`
+	Bet      int64  `json:"bet"`
+	Turnover int64  `json:"turnover"`
+	Winloss  int64  `json:"winloss"`
+}
+
+// DayCheck compares one day of the source with the target.
+type DayCheck struct {
+	Date   string    `json:"date"`
+	Source DayTotals `json:"source"`
+	Target DayTotals `json:"target"`
+}
+
+func (c DayCheck) Match() bool {
+	return c.Source == c.Target
+}
+
+type BackfillResult struct {
+	Rows         int64         `json:"rows"` // read from the source, resumed runs included, like Inserted and DeadLettered
+	Inserted     int64         `json:"inserted"`
+	DeadLettered int64         `json:"dead_lettered"`
+	Resumed      bool          `json:"resumed"`
+	Took         time.Duration `json:"took"`
+	Days         []DayCheck    `json:"days"`
+	Mismatches   int           `json:"mismatches"`
+}
+
+// Backfill streams the reports of cfg.Source matching cfg.Filter into cfg.Target in
+// (bet_time, transaction_id) order, through the same retries and dead letters as any other
+// write. Ingestion is idempotent, so rows copied again after a crash are skipped. Once every
+// chunk is written the per day totals of both backends are compared.
+func (s *Service) Backfill(ctx context.Context, cfg BackfillConfig) (BackfillResult, error) {
+	var result BackfillResult
+
+	if err := errors.Join(s.checkBackend(cfg.Source), s.checkBackend(cfg.Target)); err != nil {
+		return result, err
+	}
+	if cfg.Source == cfg.Target {
+		return result, errors.New("backfill source and target must differ")
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 5000
+	}
+
+	checkpoint := BackfillCheckpoint{Source: cfg.Source, Target: cfg.Target, Filter: cfg.Filter}
+	if cfg.Checkpoint != "" {
+		saved, err := loadCheckpoint(cfg.Checkpoint)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return result, err
+		case saved.Source != cfg.Source || saved.Target != cfg.Target || !sameFilter(saved.Filter, cfg.Filter):
+			return result, fmt.Errorf("checkpoint %s belongs to another backfill (%s to %s), remove it to start over", cfg.Checkpoint, saved.Source, saved.Target)
+		default:
+			checkpoint = saved
+			result.Resumed = true
+			log.Printf("[backfill] resuming after %d rows", saved.Rows)
+		}
+	}
+	result.Rows, result.Inserted, result.DeadLettered = checkpoint.Rows, checkpoint.Inserted, checkpoint.DeadLettered
+
+	startTime := time.Now()
+	opts := s.WriteOptions()
+	var copied int64 // this run only, for the rate limit
+
+	for !checkpoint.Done {
+		_, reports, next, err := s.ListReports(cfg.Source, cfg.Filter, checkpoint.After, cfg.ChunkSize)
+		if err != nil {
+			return result, fmt.Errorf("backfill read error: %w", err)
+		}
+
+		if len(reports) > 0 {
+			written := s.writeBackend(ctx, cfg.Target, reports, opts)
+			switch {
+			case written.Success:
+				checkpoint.Inserted += int64(written.Rows)
+			case written.DeadLettered:
+				checkpoint.DeadLettered += int64(len(reports))
+			default:
+				return result, fmt.Errorf("backfill write error: %s", written.Error)
+			}
+			checkpoint.Rows += int64(len(reports))
+			last := reports[len(reports)-1]
+			checkpoint.After = &domain.ReportCursor{BetTime: last.BetTime, TransactionID: last.TransactionID}
+		}
+		checkpoint.Done = next == nil
+
+		if cfg.Checkpoint != "" {
+			if err := saveCheckpoint(cfg.Checkpoint, checkpoint); err != nil {
+				return result, err
+			}
+		}
+		result.Rows, result.Inserted, result.DeadLettered = checkpoint.Rows, checkpoint.Inserted, checkpoint.DeadLettered
+
+		copied += int64(len(reports))
+		if cfg.RowsPerSecond > 0 && !checkpoint.Done {
+			due := time.Duration(float64(copied) / float64(cfg.RowsPerSecond) * float64(time.Second))
+			if !sleep(ctx, due-time.Since(startTime)) {
+				return result, ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+	}
+	result.Took = time.Since(startTime)
+
+	days, err := s.compareDays(cfg.Source, cfg.Target, cfg.Filter)
+	if err != nil {
+		return result, fmt.Errorf("backfill verify error: %w", err)
+	}
+	result.Days = days
+	for _, day := range days {
+		if !day.Match() {
+			result.Mismatches++
+		}
+	}
+
+	return result, nil
+}
+
+// compareDays puts the daily totals of both backends side by side.
+func (s *Service) compareDays(source, target string, f domain.ReportFilter) ([]DayCheck, error) {
+	sourceDays, err := s.dayTotals(source, f)
+	if err != nil {
+		return nil, err
+	}
+	targetDays, err := s.dayTotals(target, f)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make(map[string]*DayCheck)
+	check := func(date string) *DayCheck {
+		if c, ok := checks[date]; ok {
+			return c
+		}
+		checks[date] = &DayCheck{Date: date}
+		return checks[date]
+	}
+	for date, totals := range sourceDays {
+		check(date).Source = totals
+	}
+	for date, totals := range targetDays {
+		check(date).Target = totals
+	}
+
+	days := make([]DayCheck, 0, len(checks))
+	for _, c := range checks {
+		days = append(days, *c)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
+
+func (s *Service) dayTotals(backend string, f domain.ReportFilter) (map[string]DayTotals, error) {
+	_, rows, err := s.Rollup(backend, f, domain.Day)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make(map[string]DayTotals)
+	for _, row := range rows {
+		day := days[row.Date]
+		day.Count += row.TotalCount
+		day.Bet += row.TotalBet
+		day.Turnover += row.TotalTurnover
+		day.Winloss += row.TotalWinloss
+		days[row.Date] = day
+	}
+	return days, nil
+}
+
+// sameFilter compares filters by instant, a checkpoint read back from JSON loses the
+// monotonic clock and may carry another location.
+func sameFilter(a, b domain.ReportFilter) bool {
+	return a.From.Equal(b.From) && a.To.Equal(b.To) && a.BrandID == b.BrandID && a.GameID == b.GameID
+}
+
+func loadCheckpoint(path string) (BackfillCheckpoint, error) {
+	var checkpoint BackfillCheckpoint
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return checkpoint, err
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("checkpoint %s decode error: %w", path, err)
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint replaces the checkpoint through a rename, so a crash never leaves half a file.
+func saveCheckpoint(path string, checkpoint BackfillCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("checkpoint write error: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("checkpoint write error: %w", err)
+	}
+	return nil
+}
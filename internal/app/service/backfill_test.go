@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/domain"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// sourcePostgres lists stored reports in (bet_time, transaction_id) order, the rest of the
+// port is left nil.
+type sourcePostgres struct {
+	app.PostgresRepository
+	reports []domain.Report
+}
+
+func (r *sourcePostgres) ListReports(f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, error) {
+	var page []domain.Report
+	for _, report := range r.reports {
+		if after != nil && !cursorBefore(*after, report) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, report)
+	}
+	return 0, page, nil
+}
+
+func (r *sourcePostgres) Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	return 0, rollupDays(r.reports), nil
+}
+
+// targetClickhouse stores reports by transaction id, the insert numbered failOn fails.
+type targetClickhouse struct {
+	app.ClickhouseRepository
+	stored  map[string]domain.Report
+	inserts int
+	failOn  int
+	written int // rows handed to insert, repeats included
+}
+
+func (r *targetClickhouse) InsertReports(reports []domain.Report, opts app.ClickhouseWriteOptions) (int64, error) {
+	r.inserts++
+	if r.inserts == r.failOn {
+		return 0, errors.New("disk full")
+	}
+	r.written += len(reports)
+	for _, report := range reports {
+		r.stored[report.TransactionID] = report
+	}
+	return int64(len(reports)), nil
+}
+
+func (r *targetClickhouse) Rollup(f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	reports := make([]domain.Report, 0, len(r.stored))
+	for _, report := range r.stored {
+		reports = append(reports, report)
+	}
+	return 0, rollupDays(reports), nil
+}
+
+func cursorBefore(c domain.ReportCursor, r domain.Report) bool {
+	return c.BetTime.Before(r.BetTime) || c.BetTime.Equal(r.BetTime) && c.TransactionID < r.TransactionID
+}
+
+// rollupDays buckets by UTC day, like the adapters.
+func rollupDays(reports []domain.Report) []domain.SuperAggregationResult {
+	byDay := make(map[string]*domain.SuperAggregationResult)
+	for _, report := range reports {
+		date := report.BetTime.UTC().Format("2006-01-02")
+		row, ok := byDay[date]
+		if !ok {
+			row = &domain.SuperAggregationResult{Date: date}
+			byDay[date] = row
+		}
+		row.TotalCount++
+		row.TotalBet += report.Bet
+		row.TotalTurnover += report.Turnover
+		row.TotalWinloss += report.Winloss
+	}
+
+	rows := make([]domain.SuperAggregationResult, 0, len(byDay))
+	for _, row := range byDay {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Date < rows[j].Date })
+	return rows
+}
+
+func TestBackfillResumesFromCheckpoint(t *testing.T) {
+	start := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+	var reports []domain.Report
+	for i := 0; i < 10; i++ {
+		reports = append(reports, domain.Report{
+			Username:      "player",
+			TransactionID: fmt.Sprintf("tx%02d", i),
+			BetTime:       start.Add(time.Duration(i) * time.Hour), // spans two days
+			Bet:           100,
+			Turnover:      100,
+			Winloss:       int64(i),
+		})
+	}
+
+	target := &targetClickhouse{stored: make(map[string]domain.Report), failOn: 2}
+	svc := NewService(&sourcePostgres{reports: reports}, nil, target)
+	svc.SetRetryPolicy(BackendClickHouse, RetryPolicy{MaxAttempts: 1})
+
+	cfg := BackfillConfig{
+		Source:     BackendPostgres,
+		Target:     BackendClickHouse,
+		ChunkSize:  3,
+		Checkpoint: filepath.Join(t.TempDir(), "backfill.json"),
+	}
+
+	// the second chunk fails, the checkpoint keeps the first
+	if _, err := svc.Backfill(context.Background(), cfg); err == nil {
+		t.Fatal("backfill succeeded past a failed write")
+	}
+	saved, err := loadCheckpoint(cfg.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Rows != 3 || saved.Done || saved.After == nil || saved.After.TransactionID != "tx02" {
+		t.Fatalf("checkpoint %+v, want 3 rows after tx02", saved)
+	}
+
+	other := cfg
+	other.Filter.BrandID = "brand"
+	if _, err := svc.Backfill(context.Background(), other); err == nil {
+		t.Fatal("resumed a checkpoint of another backfill")
+	}
+
+	result, err := svc.Backfill(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Resumed || result.Rows != 10 || result.Inserted != 10 {
+		t.Fatalf("got %+v, want 10 rows inserted over both runs", result)
+	}
+	if target.written != 10 {
+		t.Fatalf("%d rows written, the resumed run copied the first chunk again", target.written)
+	}
+	if len(result.Days) != 2 || result.Mismatches != 0 {
+		t.Fatalf("days %+v, %d mismatches, want two matching days", result.Days, result.Mismatches)
+	}
+}
@@ -0,0 +1,541 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	QueryCount        = "count"
+	QueryProfitByGame = "profit_by_game"
+	QueryRollup       = "rollup"
+
+	maxJobEvents    = 1000 // events kept per job and replayed to late subscribers
+	maxFinishedJobs = 100  // finished jobs kept for GET /benchmarks/:id, the oldest go first
+)
+
+var (
+	ErrJobNotFound      = errors.New("benchmark job not found")
+	ErrBenchmarkRunning = errors.New("another benchmark is running")
+)
+
+// Scenario describes one benchmark run: what to generate, where to write it and what to query afterwards.
+type Scenario struct {
+	Seed        int64         `json:"seed"`
+	Total       int           `json:"total"`
+	BatchSize   int           `json:"batch_size"`
+	Concurrency int           `json:"concurrency"` // batches written at the same time
+	Profile     string        `json:"profile"`     // uniform or realistic
+	Faults      Faults        `json:"faults"`
+	Backends    []string      `json:"backends"` // defaults to every configured backend
+	Queries     []string      `json:"queries"`  // count, profit_by_game and rollup, defaults to all
+	Write       *WriteOptions `json:"write"`    // defaults to the service write options
+}
+
+func (sc *Scenario) normalize(s *Service) error {
+	if sc.Total <= 0 {
+		return errors.New("total must be positive")
+	}
+	if sc.BatchSize <= 0 {
+		sc.BatchSize = 1000
+	}
+	if sc.Concurrency <= 0 {
+		sc.Concurrency = 1
+	}
+	if sc.Profile == "" {
+		sc.Profile = "uniform"
+	}
+	if sc.Profile != "uniform" && sc.Profile != "realistic" {
+		return fmt.Errorf("unknown profile %q", sc.Profile)
+	}
+	if len(sc.Backends) == 0 {
+		sc.Backends = s.Backends()
+	}
+	for _, backend := range sc.Backends {
+		if err := s.checkBackend(backend); err != nil {
+			return err
+		}
+	}
+	if sc.Write == nil {
+		opts := s.WriteOptions()
+		sc.Write = &opts
+	}
+	if err := sc.Write.normalize(); err != nil {
+		return err
+	}
+	if err := sc.generatorConfig().Validate(); err != nil {
+		return err
+	}
+	if len(sc.Queries) == 0 {
+		sc.Queries = []string{QueryCount, QueryProfitByGame, QueryRollup}
+	}
+	for _, q := range sc.Queries {
+		if q != QueryCount && q != QueryProfitByGame && q != QueryRollup {
+			return fmt.Errorf("unknown query %q", q)
+		}
+	}
+	return nil
+}
+
+func (sc Scenario) generatorConfig() GeneratorConfig {
+	cfg := GeneratorConfig{
+		Seed:          sc.Seed,
+		ReferenceTime: DefaultReferenceTime,
+		Profile:       UniformProfile(),
+		Faults:        sc.Faults,
+	}
+	if sc.Profile == "realistic" {
+		cfg.Profile = RealisticProfile()
+	}
+	return cfg
+}
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Event is a progress update pushed to subscribers of a job.
+type Event struct {
+	Type string    `json:"type"` // status, batch or query
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+type BatchEvent struct {
+	Batch    int             `json:"batch"`
+	Rows     int             `json:"rows"`
+	Written  int64           `json:"written"`
+	Total    int             `json:"total"`
+	Backends []BackendResult `json:"backends"`
+}
+
+type QueryResult struct {
+	Query   string  `json:"query"`
+	Backend string  `json:"backend"`
+	TookMs  float64 `json:"took_ms"`
+	Rows    int64   `json:"rows"` // the count for count queries, result rows otherwise
+	Error   string  `json:"error,omitempty"`
+}
+
+// InsertTotals sum up the writes of one backend. TookMs is the wall clock of the whole insert
+// phase, which RowsPerSecond is measured against; with several backends in a scenario they
+// share it, since every batch is written to each of them in turn. BatchMs adds up the time
+// of every batch, concurrent ones overlapping.
+type InsertTotals struct {
+	Backend       string  `json:"backend"`
+	Rows          int64   `json:"rows"`
+	Duplicates    int64   `json:"duplicates"`
+	Unattributed  int64   `json:"unattributed"` // rows a write buffer couldn't tell inserted or duplicate
+	FailedBatches int     `json:"failed_batches"`
+	TookMs        float64 `json:"took_ms"`
+	BatchMs       float64 `json:"batch_ms"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+}
+
+type JobResult struct {
+	Inserts []InsertTotals `json:"inserts"`
+	Queries []QueryResult  `json:"queries"`
+}
+
+// Job is one submitted scenario. All exported accessors are safe for concurrent use.
+type Job struct {
+	ID       string
+	Scenario Scenario
+
+	mu         sync.Mutex
+	status     JobStatus
+	err        string
+	createdAt  time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	written    int64
+	result     JobResult
+	events     []Event
+	subs       map[chan Event]struct{}
+	cancel     context.CancelFunc
+}
+
+// JobSnapshot is the state of a job at one point in time.
+type JobSnapshot struct {
+	ID         string     `json:"id"`
+	Status     JobStatus  `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Scenario   Scenario   `json:"scenario"`
+	Written    int64      `json:"written"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Result     JobResult  `json:"result"`
+}
+
+func (j *Job) Snapshot() JobSnapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snap := JobSnapshot{
+		ID:        j.ID,
+		Status:    j.status,
+		Error:     j.err,
+		Scenario:  j.Scenario,
+		Written:   j.written,
+		CreatedAt: j.createdAt,
+		Result: JobResult{
+			Inserts: append([]InsertTotals(nil), j.result.Inserts...),
+			Queries: append([]QueryResult(nil), j.result.Queries...),
+		},
+	}
+	if !j.startedAt.IsZero() {
+		startedAt := j.startedAt
+		snap.StartedAt = &startedAt
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		snap.FinishedAt = &finishedAt
+	}
+	return snap
+}
+
+// Subscribe returns the events so far and a channel for the ones to come. The channel
+// is closed when the job finishes. Slow subscribers miss events rather than stall the job.
+func (j *Job) Subscribe() ([]Event, <-chan Event, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	history := append([]Event(nil), j.events...)
+	ch := make(chan Event, 64)
+
+	if j.finished() {
+		close(ch)
+		return history, ch, func() {}
+	}
+
+	j.subs[ch] = struct{}{}
+	unsubscribe := func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+	return history, ch, unsubscribe
+}
+
+func (j *Job) finished() bool {
+	return j.status == JobSucceeded || j.status == JobFailed || j.status == JobCanceled
+}
+
+// publish must be called with j.mu held.
+func (j *Job) publish(eventType string, data any) {
+	ev := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	j.events = append(j.events, ev)
+	if len(j.events) > maxJobEvents {
+		j.events = j.events[len(j.events)-maxJobEvents:]
+	}
+
+	for ch := range j.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (j *Job) setStatus(status JobStatus, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status = status
+	switch status {
+	case JobRunning:
+		j.startedAt = time.Now()
+	case JobSucceeded, JobFailed, JobCanceled:
+		j.finishedAt = time.Now()
+	}
+	if err != nil {
+		j.err = err.Error()
+	}
+
+	j.publish("status", map[string]any{"status": status, "error": j.err})
+
+	if j.finished() {
+		for ch := range j.subs {
+			close(ch)
+		}
+		j.subs = map[chan Event]struct{}{}
+	}
+}
+
+// Benchmarks runs scenarios as background jobs, one at a time so runs don't skew each other.
+type Benchmarks struct {
+	svc *Service
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running *Job
+	idle    chan struct{} // closed when running goes back to nil
+}
+
+func NewBenchmarks(svc *Service) *Benchmarks {
+	return &Benchmarks{svc: svc, jobs: make(map[string]*Job)}
+}
+
+func (b *Benchmarks) Submit(sc Scenario) (*Job, error) {
+	if err := sc.normalize(b.svc); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBenchmarkRunning, b.running.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        uuid.NewString(),
+		Scenario:  sc,
+		status:    JobQueued,
+		createdAt: time.Now(),
+		subs:      make(map[chan Event]struct{}),
+		cancel:    cancel,
+	}
+	b.prune()
+	b.jobs[job.ID] = job
+	b.running = job
+	idle := make(chan struct{})
+	b.idle = idle
+
+	go func() {
+		defer cancel()
+		b.run(ctx, job)
+
+		b.mu.Lock()
+		b.running = nil
+		close(idle)
+		b.mu.Unlock()
+	}()
+
+	return job, nil
+}
+
+// prune forgets the oldest finished jobs beyond maxFinishedJobs, b.mu must be held.
+func (b *Benchmarks) prune() {
+	type finishedJob struct {
+		id string
+		at time.Time
+	}
+	var finished []finishedJob
+	for id, job := range b.jobs {
+		job.mu.Lock()
+		if job.finished() {
+			finished = append(finished, finishedJob{id, job.finishedAt})
+		}
+		job.mu.Unlock()
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool { return finished[i].at.Before(finished[j].at) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(b.jobs, job.id)
+	}
+}
+
+func (b *Benchmarks) Get(id string) (*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job, ok := b.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Cancel stops a job through its context. The job finishes with status canceled after its
+// current batch or query.
+func (b *Benchmarks) Cancel(id string) (*Job, error) {
+	job, err := b.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	job.cancel()
+	return job, nil
+}
+
+// Shutdown cancels the running job, if any, and waits for it to stop or for ctx to be done.
+func (b *Benchmarks) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	if b.running == nil {
+		b.mu.Unlock()
+		return nil
+	}
+	b.running.cancel()
+	idle := b.idle
+	b.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Benchmarks) run(ctx context.Context, job *Job) {
+	job.setStatus(JobRunning, nil)
+
+	if err := b.seed(ctx, job); err != nil {
+		b.finish(ctx, job, err)
+		return
+	}
+
+	b.finish(ctx, job, b.query(ctx, job))
+}
+
+func (b *Benchmarks) finish(ctx context.Context, job *Job, err error) {
+	switch {
+	case ctx.Err() != nil:
+		job.setStatus(JobCanceled, ctx.Err())
+	case err != nil:
+		job.setStatus(JobFailed, err)
+	default:
+		job.setStatus(JobSucceeded, nil)
+	}
+}
+
+func (b *Benchmarks) seed(ctx context.Context, job *Job) error {
+	sc := job.Scenario
+	cfg := sc.generatorConfig()
+	cfg.IDPrefix = job.ID + "_" // every job inserts new rows, the same seed or not
+	generator, err := NewGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	batches := generator.Batches(ctx, sc.Total, sc.BatchSize)
+
+	totals := make(map[string]*InsertTotals, len(sc.Backends))
+	for _, backend := range sc.Backends {
+		totals[backend] = &InsertTotals{Backend: backend}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		batchNo int
+		mu      sync.Mutex // guards totals
+	)
+	semaphore := make(chan struct{}, sc.Concurrency)
+	startTime := time.Now()
+
+	for batch := range batches {
+		batchNo++
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(n int, batch []domain.Report) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			results := b.svc.WriteReportsWith(ctx, sc.Backends, batch, *sc.Write)
+
+			mu.Lock()
+			for _, r := range results {
+				t := totals[r.Backend]
+				t.BatchMs += float64(r.Took) / float64(time.Millisecond)
+				if r.Success {
+					t.Rows += int64(r.Rows)
+					t.Duplicates += int64(r.Duplicates)
+					t.Unattributed += int64(r.Unattributed)
+				} else {
+					t.FailedBatches++
+				}
+			}
+			mu.Unlock()
+
+			job.mu.Lock()
+			job.written += int64(len(batch))
+			job.publish("batch", BatchEvent{
+				Batch:    n,
+				Rows:     len(batch),
+				Written:  job.written,
+				Total:    sc.Total,
+				Backends: results,
+			})
+			job.mu.Unlock()
+		}(batchNo, batch)
+	}
+	wg.Wait()
+	took := float64(time.Since(startTime)) / float64(time.Millisecond)
+
+	inserts := make([]InsertTotals, 0, len(sc.Backends))
+	for _, backend := range sc.Backends {
+		t := *totals[backend]
+		t.TookMs = took
+		if t.TookMs > 0 {
+			t.RowsPerSecond = float64(t.Rows) / (t.TookMs / 1000)
+		}
+		inserts = append(inserts, t)
+	}
+
+	job.mu.Lock()
+	job.result.Inserts = inserts
+	job.mu.Unlock()
+
+	return ctx.Err()
+}
+
+func (b *Benchmarks) query(ctx context.Context, job *Job) error {
+	for _, q := range job.Scenario.Queries {
+		for _, backend := range job.Scenario.Backends {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			result := QueryResult{Query: q, Backend: backend}
+
+			var (
+				took time.Duration
+				err  error
+			)
+			switch q {
+			case QueryCount:
+				took, result.Rows, err = b.svc.CountReports(backend, domain.ReportFilter{})
+			case QueryProfitByGame:
+				var rows []domain.ProfitAggregationResult
+				took, rows, err = b.svc.ProfitByGame(backend, domain.ReportFilter{})
+				result.Rows = int64(len(rows))
+			case QueryRollup:
+				var rows []domain.SuperAggregationResult
+				took, rows, err = b.svc.Rollup(backend, domain.ReportFilter{}, domain.Day)
+				result.Rows = int64(len(rows))
+			}
+			result.TookMs = float64(took) / float64(time.Millisecond)
+			if err != nil {
+				result.Error = err.Error()
+			}
+
+			job.mu.Lock()
+			job.result.Queries = append(job.result.Queries, result)
+			job.publish("query", result)
+			job.mu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/domain"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+var ErrBufferClosed = errors.New("report buffer closed")
+
+type BufferConfig struct {
+	MaxRows    int           // flush once this many rows are buffered
+	MaxDelay   time.Duration // flush at most this long after the first row of a batch arrived
+	MaxPending int           // rows buffered or being flushed before Submit blocks
+	MaxWait    time.Duration // how long the decorators' writes and flushes wait before failing
+}
+
+// InsertedUnknown is the Inserted of a Submit whose flush carried other Submits too and
+// skipped some rows as duplicates, without saying whose they were.
+const InsertedUnknown = -1
+
+// FlushResult is what one Submit learns about the flush that carried its reports.
+type FlushResult struct {
+	Rows     int   // rows of this Submit
+	Inserted int64 // rows of this Submit inserted, or InsertedUnknown
+	Err      error
+}
+
+type bufferedWrite struct {
+	reports  []domain.Report
+	acquired int64
+	done     func(FlushResult)
+	flushed  chan struct{} // set by Flush instead of reports, closed once the flush is done
+}
+
+// ReportBuffer collects reports from many small writes and inserts them together, once
+// MaxRows accumulate or MaxDelay passes, whichever comes first. Flushes run one at a time.
+// Writers block once MaxPending rows are waiting, so a slow backend pushes back on them
+// instead of growing the buffer without bound.
+type ReportBuffer struct {
+	insert func([]domain.Report) (int64, error)
+	cfg    BufferConfig
+	space  *semaphore.Weighted
+
+	mu      sync.RWMutex
+	closed  bool
+	in      chan bufferedWrite
+	stopped chan struct{}
+}
+
+func NewReportBuffer(insert func([]domain.Report) (int64, error), cfg BufferConfig) *ReportBuffer {
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = 10000
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = time.Second
+	}
+	if cfg.MaxPending < cfg.MaxRows {
+		cfg.MaxPending = cfg.MaxRows * 4
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = time.Minute
+	}
+
+	b := &ReportBuffer{
+		insert:  insert,
+		cfg:     cfg,
+		space:   semaphore.NewWeighted(int64(cfg.MaxPending)),
+		in:      make(chan bufferedWrite, 1024),
+		stopped: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Submit queues the reports and returns without waiting for the flush, done is called
+// with the outcome once they're flushed. It blocks while the buffer is full, until ctx is done.
+func (b *ReportBuffer) Submit(ctx context.Context, reports []domain.Report, done func(FlushResult)) error {
+	if len(reports) == 0 {
+		done(FlushResult{})
+		return nil
+	}
+
+	// a write larger than the whole buffer waits for it to drain instead of forever
+	acquired := min(int64(len(reports)), int64(b.cfg.MaxPending))
+	if err := b.space.Acquire(ctx, acquired); err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		b.space.Release(acquired)
+		return ErrBufferClosed
+	}
+	select {
+	case b.in <- bufferedWrite{reports: reports, acquired: acquired, done: done}:
+		return nil
+	case <-ctx.Done():
+		b.space.Release(acquired)
+		return ctx.Err()
+	}
+}
+
+// Write is Submit waiting for the flush, until ctx is done. The reports of a Write that
+// gave up waiting stay queued and may still be written.
+func (b *ReportBuffer) Write(ctx context.Context, reports []domain.Report) (int64, error) {
+	result := make(chan FlushResult, 1)
+	if err := b.Submit(ctx, reports, func(r FlushResult) { result <- r }); err != nil {
+		return 0, err
+	}
+	select {
+	case r := <-result:
+		return r.Inserted, r.Err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// write is Write for the decorators, bounded by MaxWait: the ports they implement take no
+// context, and a stuck backend mustn't hold their callers forever.
+func (b *ReportBuffer) write(reports []domain.Report) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.MaxWait)
+	defer cancel()
+	return b.Write(ctx, reports)
+}
+
+// Flush writes what was submitted before it without waiting for MaxRows or MaxDelay.
+func (b *ReportBuffer) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		flushed = b.stopped // Close flushes the rest
+	} else {
+		select {
+		case b.in <- bufferedWrite{flushed: flushed}:
+			b.mu.RUnlock()
+		case <-ctx.Done():
+			b.mu.RUnlock()
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes what is buffered and stops, later writes fail with ErrBufferClosed.
+func (b *ReportBuffer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.in)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *ReportBuffer) run() {
+	defer close(b.stopped)
+
+	var (
+		batch   []domain.Report
+		writes  []bufferedWrite
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		inserted, err := b.insert(batch)
+
+		for _, w := range writes {
+			b.space.Release(w.acquired)
+
+			result := FlushResult{Rows: len(w.reports), Err: err}
+			if err == nil {
+				result.Inserted = attribute(inserted, len(batch), len(w.reports), len(writes))
+			}
+			w.done(result)
+		}
+
+		batch, writes = nil, nil
+	}
+
+	for {
+		select {
+		case w, ok := <-b.in:
+			if !ok {
+				flush()
+				return
+			}
+			if w.flushed != nil {
+				flush()
+				close(w.flushed)
+				continue
+			}
+			if len(batch) == 0 {
+				timer = time.NewTimer(b.cfg.MaxDelay)
+				timeout = timer.C
+			}
+			batch = append(batch, w.reports...)
+			writes = append(writes, w)
+			if len(batch) >= b.cfg.MaxRows {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+// attribute returns how many of the rows of one of writes the flush inserted, as far as that
+// is known: the insert only counts the whole flush.
+func attribute(inserted int64, flushed, rows, writes int) int64 {
+	switch {
+	case writes == 1:
+		return inserted
+	case inserted == int64(flushed):
+		return int64(rows)
+	case inserted == 0:
+		return 0
+	default:
+		return InsertedUnknown
+	}
+}
+
+// The decorators below put a ReportBuffer in front of the batch insert of a repository.
+// Every other call goes straight through; Close flushes the buffer before closing the client
+// and DeletePlayerData before deleting, so no buffered report of the player is written after.
+// Their batch inserts return InsertedUnknown when the rows were flushed together with other
+// writes and some of the flush were duplicates.
+
+type bufferedPostgres struct {
+	app.PostgresRepository
+	buf       *ReportBuffer
+	copyBuf   *ReportBuffer
+	directBuf *ReportBuffer
+}
+
+func BufferPostgres(r app.PostgresRepository, cfg BufferConfig) app.PostgresRepository {
+	if r == nil {
+		return nil
+	}
+	return &bufferedPostgres{
+		PostgresRepository: r,
+		buf:                NewReportBuffer(r.CreateManyReports, cfg),
+		copyBuf:            NewReportBuffer(r.CopyReports, cfg),
+		directBuf:          NewReportBuffer(r.CopyReportsDirect, cfg),
+	}
+}
+
+func (r *bufferedPostgres) CreateManyReports(reports []domain.Report) (int64, error) {
+	return r.buf.write(reports)
+}
+
+func (r *bufferedPostgres) CopyReports(reports []domain.Report) (int64, error) {
+	return r.copyBuf.write(reports)
+}
+
+func (r *bufferedPostgres) CopyReportsDirect(reports []domain.Report) (int64, error) {
+	return r.directBuf.write(reports)
+}
+
+func (r *bufferedPostgres) DeletePlayerData(username string) (int64, error) {
+	if err := flushAll([]*ReportBuffer{r.buf, r.copyBuf, r.directBuf}); err != nil {
+		return 0, err
+	}
+	return r.PostgresRepository.DeletePlayerData(username)
+}
+
+func (r *bufferedPostgres) Close() error {
+	return errors.Join(closeAll([]*ReportBuffer{r.buf, r.copyBuf, r.directBuf}), r.PostgresRepository.Close())
+}
+
+// bufferedMongo keeps a buffer per reports collection and write options, a flush can only
+// carry one set of options.
+type bufferedMongo struct {
+	app.MongoRepository
+	cfg BufferConfig
+
+	mu      sync.Mutex
+	closed  bool
+	buffers map[mongoBufferKey]*ReportBuffer
+}
+
+type mongoBufferKey struct {
+	collection string
+	opts       app.MongoWriteOptions
+}
+
+func BufferMongo(r app.MongoRepository, cfg BufferConfig) app.MongoRepository {
+	if r == nil {
+		return nil
+	}
+	return &bufferedMongo{MongoRepository: r, cfg: cfg, buffers: make(map[mongoBufferKey]*ReportBuffer)}
+}
+
+func (r *bufferedMongo) InsertReports(collection string, reports []domain.Report, opts app.MongoWriteOptions) (int64, error) {
+	key := mongoBufferKey{collection: collection, opts: opts}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, ErrBufferClosed
+	}
+	buf, ok := r.buffers[key]
+	if !ok {
+		insert := func(reports []domain.Report) (int64, error) {
+			return r.MongoRepository.InsertReports(collection, reports, opts)
+		}
+		buf = NewReportBuffer(insert, r.cfg)
+		r.buffers[key] = buf
+	}
+	r.mu.Unlock()
+
+	return buf.write(reports)
+}
+
+func (r *bufferedMongo) DeletePlayerData(collection, username string) (int64, error) {
+	r.mu.Lock()
+	var buffers []*ReportBuffer
+	for key, buf := range r.buffers {
+		if key.collection == collection {
+			buffers = append(buffers, buf)
+		}
+	}
+	r.mu.Unlock()
+
+	if err := flushAll(buffers); err != nil {
+		return 0, err
+	}
+	return r.MongoRepository.DeletePlayerData(collection, username)
+}
+
+func (r *bufferedMongo) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	buffers := r.buffers
+	r.buffers = nil
+	r.mu.Unlock()
+
+	var all []*ReportBuffer
+	for _, buf := range buffers {
+		all = append(all, buf)
+	}
+	return errors.Join(closeAll(all), r.MongoRepository.Close())
+}
+
+// bufferedClickhouse keeps a buffer per write options, like bufferedMongo.
+type bufferedClickhouse struct {
+	app.ClickhouseRepository
+	cfg BufferConfig
+
+	mu      sync.Mutex
+	closed  bool
+	buffers map[app.ClickhouseWriteOptions]*ReportBuffer
+}
+
+func BufferClickhouse(r app.ClickhouseRepository, cfg BufferConfig) app.ClickhouseRepository {
+	if r == nil {
+		return nil
+	}
+	return &bufferedClickhouse{ClickhouseRepository: r, cfg: cfg, buffers: make(map[app.ClickhouseWriteOptions]*ReportBuffer)}
+}
+
+func (r *bufferedClickhouse) InsertManyReportBatch(reports []domain.Report) (int64, error) {
+	return r.InsertReports(reports, app.ClickhouseWriteOptions{})
+}
+
+func (r *bufferedClickhouse) InsertReports(reports []domain.Report, opts app.ClickhouseWriteOptions) (int64, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, ErrBufferClosed
+	}
+	buf, ok := r.buffers[opts]
+	if !ok {
+		insert := func(reports []domain.Report) (int64, error) {
+			return r.ClickhouseRepository.InsertReports(reports, opts)
+		}
+		buf = NewReportBuffer(insert, r.cfg)
+		r.buffers[opts] = buf
+	}
+	r.mu.Unlock()
+
+	return buf.write(reports)
+}
+
+func (r *bufferedClickhouse) DeletePlayerData(username string) (int64, error) {
+	r.mu.Lock()
+	buffers := make([]*ReportBuffer, 0, len(r.buffers))
+	for _, buf := range r.buffers {
+		buffers = append(buffers, buf)
+	}
+	r.mu.Unlock()
+
+	if err := flushAll(buffers); err != nil {
+		return 0, err
+	}
+	return r.ClickhouseRepository.DeletePlayerData(username)
+}
+
+func (r *bufferedClickhouse) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	buffers := r.buffers
+	r.buffers = nil
+	r.mu.Unlock()
+
+	var all []*ReportBuffer
+	for _, buf := range buffers {
+		all = append(all, buf)
+	}
+	return errors.Join(closeAll(all), r.ClickhouseRepository.Close())
+}
+
+// flushAll flushes the buffers, each waiting up to its MaxWait.
+func flushAll(buffers []*ReportBuffer) error {
+	var errs []error
+	for _, buf := range buffers {
+		ctx, cancel := context.WithTimeout(context.Background(), buf.cfg.MaxWait)
+		errs = append(errs, buf.Flush(ctx))
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// closeAll closes the buffers, each waiting up to its MaxWait for the last flush.
+func closeAll(buffers []*ReportBuffer) error {
+	var errs []error
+	for _, buf := range buffers {
+		ctx, cancel := context.WithTimeout(context.Background(), buf.cfg.MaxWait)
+		errs = append(errs, buf.Close(ctx))
+		cancel()
+	}
+	return errors.Join(errs...)
+}
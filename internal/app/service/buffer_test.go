@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hexgonaldb/internal/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInsert records the flushes of a ReportBuffer. An insert waits for release when it
+// is set, and fails with err.
+type fakeInsert struct {
+	release chan struct{}
+	err     error
+
+	mu      sync.Mutex
+	flushes [][]domain.Report
+}
+
+func (f *fakeInsert) insert(reports []domain.Report) (int64, error) {
+	if f.release != nil {
+		<-f.release
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes = append(f.flushes, reports)
+	if f.err != nil {
+		return 0, f.err
+	}
+	return int64(len(reports)), nil
+}
+
+func (f *fakeInsert) flushSizes() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var sizes []int
+	for _, flush := range f.flushes {
+		sizes = append(sizes, len(flush))
+	}
+	return sizes
+}
+
+func blankReports(n int) []domain.Report {
+	return make([]domain.Report, n)
+}
+
+// submit submits the reports and returns the channel their FlushResult arrives on.
+func submit(t *testing.T, b *ReportBuffer, n int) <-chan FlushResult {
+	t.Helper()
+	result := make(chan FlushResult, 1)
+	if err := b.Submit(context.Background(), blankReports(n), func(r FlushResult) { result <- r }); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func await(t *testing.T, result <-chan FlushResult) FlushResult {
+	t.Helper()
+	select {
+	case r := <-result:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("the reports weren't flushed")
+		return FlushResult{}
+	}
+}
+
+func TestReportBufferFlushesAtMaxRows(t *testing.T) {
+	f := &fakeInsert{}
+	b := NewReportBuffer(f.insert, BufferConfig{MaxRows: 3, MaxDelay: time.Hour})
+	defer b.Close(context.Background())
+
+	first := submit(t, b, 2)
+	second := submit(t, b, 1)
+
+	for _, r := range []FlushResult{await(t, first), await(t, second)} {
+		if r.Err != nil || r.Inserted != int64(r.Rows) {
+			t.Errorf("got %+v, want all rows inserted", r)
+		}
+	}
+	if sizes := f.flushSizes(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Fatalf("flushes %v, want one of 3 rows", sizes)
+	}
+}
+
+func TestReportBufferFlushesAfterMaxDelay(t *testing.T) {
+	f := &fakeInsert{}
+	b := NewReportBuffer(f.insert, BufferConfig{MaxRows: 100, MaxDelay: 20 * time.Millisecond})
+	defer b.Close(context.Background())
+
+	start := time.Now()
+	inserted, err := b.Write(context.Background(), blankReports(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 1 {
+		t.Errorf("inserted %d, want 1", inserted)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("flushed after %v, before MaxDelay", elapsed)
+	}
+}
+
+func TestReportBufferSubmitBlocksAtMaxPending(t *testing.T) {
+	f := &fakeInsert{release: make(chan struct{})}
+	b := NewReportBuffer(f.insert, BufferConfig{MaxRows: 2, MaxDelay: time.Hour, MaxPending: 2})
+	release := sync.OnceFunc(func() { close(f.release) })
+	defer func() {
+		release()
+		b.Close(context.Background())
+	}()
+
+	// the flush of these two rows is stuck in the insert and holds all of MaxPending
+	first := submit(t, b, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := b.Submit(ctx, blankReports(1), func(FlushResult) {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want Submit to block until the deadline", err)
+	}
+
+	release()
+	await(t, first)
+
+	// the space is released once the flush is done
+	second := submit(t, b, 1)
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	await(t, second)
+}
+
+func TestReportBufferCloseFlushesTheRest(t *testing.T) {
+	f := &fakeInsert{}
+	b := NewReportBuffer(f.insert, BufferConfig{MaxRows: 100, MaxDelay: time.Hour})
+
+	result := submit(t, b, 2)
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := await(t, result); r.Err != nil || r.Inserted != 2 {
+		t.Fatalf("got %+v, want 2 rows inserted", r)
+	}
+
+	err := b.Submit(context.Background(), blankReports(1), func(FlushResult) {})
+	if !errors.Is(err, ErrBufferClosed) {
+		t.Fatalf("got %v after Close, want ErrBufferClosed", err)
+	}
+}
+
+func TestReportBufferFlushAfterClose(t *testing.T) {
+	f := &fakeInsert{}
+	b := NewReportBuffer(f.insert, BufferConfig{MaxRows: 100, MaxDelay: time.Hour})
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReportBufferErrorReachesEveryWrite(t *testing.T) {
+	insertErr := errors.New("connection reset")
+	f := &fakeInsert{err: insertErr}
+	b := NewReportBuffer(f.insert, BufferConfig{MaxRows: 3, MaxDelay: time.Hour})
+	defer b.Close(context.Background())
+
+	results := []<-chan FlushResult{submit(t, b, 1), submit(t, b, 1), submit(t, b, 1)}
+	for i, result := range results {
+		if r := await(t, result); !errors.Is(r.Err, insertErr) || r.Inserted != 0 {
+			t.Errorf("write %d got %+v, want the insert error", i, r)
+		}
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	tests := []struct {
+		name                  string
+		inserted              int64
+		flushed, rows, writes int
+		want                  int64
+	}{
+		{"single write", 3, 5, 5, 1, 3},
+		{"all inserted", 5, 5, 2, 3, 2},
+		{"none inserted", 0, 5, 2, 3, 0},
+		{"some duplicates", 4, 5, 2, 3, InsertedUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attribute(tt.inserted, tt.flushed, tt.rows, tt.writes); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
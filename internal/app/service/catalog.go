@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"os"
+	"path/filepath"
+)
+
+var providers = []domain.Provider{
+	{ID: "pgsoft", Name: "PG Soft"},
+	{ID: "evolution", Name: "Evolution"},
+	{ID: "evolutionlive", Name: "Evolution Live"},
+	{ID: "netent", Name: "NetEnt"},
+	{ID: "playtech", Name: "Playtech"},
+	{ID: "pragmatic", Name: "Pragmatic Play"},
+	{ID: "redtiger", Name: "Red Tiger"},
+	{ID: "quickspin", Name: "Quickspin"},
+	{ID: "microgaming", Name: "Microgaming"},
+	{ID: "yggdrasil", Name: "Yggdrasil"},
+}
+
+var gameTypes = []string{"slot", "live", "table", "crash", "fishing"}
+
+// NewCatalog builds a fixed catalog of brands and games. Games are spread over
+// the providers in round robin, so the same counts always give the same catalog.
+func NewCatalog(brands, games int) domain.Catalog {
+	c := domain.Catalog{
+		Brands:    make([]domain.Brand, brands),
+		Providers: append([]domain.Provider(nil), providers...),
+		Games:     make([]domain.Game, games),
+	}
+
+	for i := range c.Brands {
+		c.Brands[i] = domain.Brand{
+			ID:   fmt.Sprintf("brand%d", i),
+			Name: fmt.Sprintf("Brand %d", i),
+		}
+	}
+
+	for i := range c.Games {
+		provider := providers[i%len(providers)]
+		gameType := gameTypes[(i/len(providers))%len(gameTypes)]
+		if provider.ID == "evolution" || provider.ID == "evolutionlive" {
+			gameType = "live"
+		}
+
+		c.Games[i] = domain.Game{
+			ID:         fmt.Sprintf("game%d", i),
+			Name:       fmt.Sprintf("Game %d", i),
+			Type:       gameType,
+			ProviderID: provider.ID,
+		}
+	}
+
+	return c
+}
+
+// WriteCatalog exports the catalog as brands.csv, providers.csv and games.csv in dir,
+// ready to be loaded as dimension tables.
+func WriteCatalog(dir string, c domain.Catalog) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create catalog dir error: %w", err)
+	}
+
+	brands := [][]string{{"brand_id", "brand_name"}}
+	for _, b := range c.Brands {
+		brands = append(brands, []string{b.ID, b.Name})
+	}
+
+	providerRows := [][]string{{"provider_id", "provider_name"}}
+	for _, p := range c.Providers {
+		providerRows = append(providerRows, []string{p.ID, p.Name})
+	}
+
+	games := [][]string{{"game_id", "game_name", "game_type", "provider_id"}}
+	for _, g := range c.Games {
+		games = append(games, []string{g.ID, g.Name, g.Type, g.ProviderID})
+	}
+
+	files := map[string][][]string{
+		"brands.csv":    brands,
+		"providers.csv": providerRows,
+		"games.csv":     games,
+	}
+	for name, records := range files {
+		if err := writeCSV(filepath.Join(dir, name), records); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCSV(path string, records [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s error: %w", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("write %s error: %w", path, err)
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"time"
+)
+
+// InvalidCorrection is a correction ApplyCorrections refused, by its index in the batch.
+type InvalidCorrection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type InvalidCorrectionsError []InvalidCorrection
+
+func (e InvalidCorrectionsError) Error() string {
+	return fmt.Sprintf("%d invalid corrections", len(e))
+}
+
+// ApplyCorrections voids or resettles bets. A correction is the whole report again, with
+// the same transaction_id and bet_time, status void or resettled and a version above the
+// stored one. A bet_time other than the stored one is refused: ClickHouse sorts by
+// (bet_time, transaction_id) and would keep the correction next to the original. Every
+// backend keeps only the highest version of a transaction: Postgres upserts, MongoDB
+// replaces the document by transaction_id and ClickHouse keeps both rows until
+// ReplacingMergeTree collapses them, reading FINAL meanwhile. Corrections not newer than
+// the stored version are counted as duplicates. Nothing is written unless every
+// correction is valid.
+func (s *Service) ApplyCorrections(ctx context.Context, corrections []domain.Report) ([]BackendResult, error) {
+	var invalid InvalidCorrectionsError
+	for i, correction := range corrections {
+		if err := correction.ValidateCorrection(); err != nil {
+			invalid = append(invalid, InvalidCorrection{Index: i, Error: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+
+	invalid, err := s.checkBetTimes(corrections)
+	if err != nil {
+		return nil, err
+	}
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+
+	return s.WriteReports(ctx, corrections), nil
+}
+
+// checkBetTimes compares the bet_time of every correction with the one each configured
+// backend stores for its transaction, to the second ClickHouse keeps. Transactions not
+// stored yet pass.
+func (s *Service) checkBetTimes(corrections []domain.Report) (InvalidCorrectionsError, error) {
+	ids := make([]string, len(corrections))
+	for i, correction := range corrections {
+		ids[i] = correction.TransactionID
+	}
+
+	var invalid InvalidCorrectionsError
+	for _, backend := range s.Backends() {
+		var (
+			stored map[string]time.Time
+			err    error
+		)
+		switch backend {
+		case BackendPostgres:
+			stored, err = s.postgres.BetTimes(ids)
+		case BackendMongo:
+			stored, err = s.mongo.BetTimes("reports", ids)
+		default:
+			stored, err = s.click.BetTimes(ids)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s bet time lookup error: %w", backend, err)
+		}
+
+		for i, correction := range corrections {
+			betTime, ok := stored[correction.TransactionID]
+			if ok && !betTime.Truncate(time.Second).Equal(correction.BetTime.Truncate(time.Second)) {
+				invalid = append(invalid, InvalidCorrection{
+					Index: i,
+					Error: fmt.Sprintf("bet_time %s differs from the stored %s in %s", correction.BetTime.Format(time.RFC3339), betTime.Format(time.RFC3339), backend),
+				})
+			}
+		}
+	}
+	return invalid, nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/domain"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// betTimePostgres and betTimeClickhouse answer BetTimes from a map, the rest of the port is left nil.
+type betTimePostgres struct {
+	app.PostgresRepository
+	stored map[string]time.Time
+	calls  int
+}
+
+func (r *betTimePostgres) BetTimes(ids []string) (map[string]time.Time, error) {
+	r.calls++
+	return pick(r.stored, ids), nil
+}
+
+type betTimeClickhouse struct {
+	app.ClickhouseRepository
+	stored map[string]time.Time
+	err    error
+}
+
+func (r *betTimeClickhouse) BetTimes(ids []string) (map[string]time.Time, error) {
+	return pick(r.stored, ids), r.err
+}
+
+func pick(stored map[string]time.Time, ids []string) map[string]time.Time {
+	found := make(map[string]time.Time)
+	for _, id := range ids {
+		if t, ok := stored[id]; ok {
+			found[id] = t
+		}
+	}
+	return found
+}
+
+func correction(id string, betTime time.Time) domain.Report {
+	return domain.Report{
+		Username:      "player",
+		TransactionID: id,
+		BetTime:       betTime,
+		BrandID:       "brand",
+		GameID:        "game",
+		Currency:      "USD",
+		Status:        domain.Void,
+		Version:       2,
+	}
+}
+
+func TestCheckBetTimes(t *testing.T) {
+	betTime := time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		postgres    map[string]time.Time
+		clickhouse  map[string]time.Time
+		corrections []domain.Report
+		wantIndexes []int
+	}{
+		{
+			name:        "not stored yet",
+			corrections: []domain.Report{correction("tx1", betTime)},
+		},
+		{
+			name:        "same bet time",
+			postgres:    map[string]time.Time{"tx1": betTime},
+			clickhouse:  map[string]time.Time{"tx1": betTime},
+			corrections: []domain.Report{correction("tx1", betTime)},
+		},
+		{
+			name:        "same second",
+			postgres:    map[string]time.Time{"tx1": betTime.Add(300 * time.Millisecond)},
+			clickhouse:  map[string]time.Time{"tx1": betTime},
+			corrections: []domain.Report{correction("tx1", betTime.Add(700*time.Millisecond))},
+		},
+		{
+			name:        "same instant in another zone",
+			postgres:    map[string]time.Time{"tx1": betTime},
+			corrections: []domain.Report{correction("tx1", betTime.In(time.FixedZone("UTC+8", 8*3600)))},
+		},
+		{
+			name:        "other bet time",
+			postgres:    map[string]time.Time{"tx1": betTime, "tx2": betTime},
+			corrections: []domain.Report{correction("tx1", betTime), correction("tx2", betTime.Add(time.Second))},
+			wantIndexes: []int{1},
+		},
+		{
+			name:        "differs in every backend",
+			postgres:    map[string]time.Time{"tx1": betTime},
+			clickhouse:  map[string]time.Time{"tx1": betTime},
+			corrections: []domain.Report{correction("tx1", betTime.Add(time.Hour))},
+			wantIndexes: []int{0, 0},
+		},
+		{
+			name:        "differs in one backend",
+			postgres:    map[string]time.Time{"tx1": betTime},
+			clickhouse:  map[string]time.Time{"tx1": betTime.Add(-time.Minute)},
+			corrections: []domain.Report{correction("tx1", betTime)},
+			wantIndexes: []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(&betTimePostgres{stored: tt.postgres}, nil, &betTimeClickhouse{stored: tt.clickhouse})
+
+			invalid, err := svc.checkBetTimes(tt.corrections)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var indexes []int
+			for _, c := range invalid {
+				indexes = append(indexes, c.Index)
+			}
+			if !reflect.DeepEqual(indexes, tt.wantIndexes) {
+				t.Fatalf("invalid indexes %v, want %v: %v", indexes, tt.wantIndexes, invalid)
+			}
+		})
+	}
+}
+
+func TestCheckBetTimesLookupError(t *testing.T) {
+	lookupErr := errors.New("connection refused")
+	svc := NewService(nil, nil, &betTimeClickhouse{err: lookupErr})
+
+	_, err := svc.checkBetTimes([]domain.Report{correction("tx1", time.Now())})
+	if !errors.Is(err, lookupErr) {
+		t.Fatalf("got %v, want the lookup error", err)
+	}
+}
+
+func TestApplyCorrectionsRejects(t *testing.T) {
+	betTime := time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC)
+	settled := correction("tx2", betTime)
+	settled.Status = domain.Settled
+
+	tests := []struct {
+		name        string
+		corrections []domain.Report
+		want        InvalidCorrectionsError
+		lookups     int
+	}{
+		{
+			name:        "invalid corrections aren't looked up",
+			corrections: []domain.Report{correction("tx1", betTime), settled},
+			want:        InvalidCorrectionsError{{Index: 1, Error: "a correction's status must be void or resettled"}},
+		},
+		{
+			name:        "moved bet time",
+			corrections: []domain.Report{correction("tx1", betTime.Add(time.Hour))},
+			want: InvalidCorrectionsError{{
+				Index: 0,
+				Error: "bet_time 2024-05-01T11:00:00Z differs from the stored 2024-05-01T10:00:00Z in postgres",
+			}},
+			lookups: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := &betTimePostgres{stored: map[string]time.Time{"tx1": betTime}}
+			svc := NewService(pg, nil, nil)
+
+			results, err := svc.ApplyCorrections(context.Background(), tt.corrections)
+			if results != nil {
+				t.Fatalf("corrections were written: %+v", results)
+			}
+
+			var invalid InvalidCorrectionsError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("got %v, want InvalidCorrectionsError", err)
+			}
+			if !reflect.DeepEqual(invalid, tt.want) {
+				t.Fatalf("got %+v, want %+v", invalid, tt.want)
+			}
+			if got := invalid.Error(); got != fmt.Sprintf("%d invalid corrections", len(tt.want)) {
+				t.Fatalf("error message %q", got)
+			}
+			if pg.calls != tt.lookups {
+				t.Fatalf("looked up bet times %d times, want %d", pg.calls, tt.lookups)
+			}
+		})
+	}
+}
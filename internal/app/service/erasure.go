@@ -0,0 +1,94 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNoErasureLog = errors.New("player data deletion needs an erasure log")
+
+// DeletePlayerData deletes every report of username from every configured backend and the
+// dead letters, and audits what each one removed. Buffered backends flush before deleting.
+// A failing store doesn't stop the others. The record is written either way and the
+// failures are returned joined, the deletion can simply be repeated.
+//
+// Reports read by the relay or a dead letter replay before the deletion would be written
+// again after it, so both are fenced off: the relay finishes the batch it's delivering
+// first and reads the outbox again afterwards, when Postgres has removed the player from
+// it, and a replay, in any process, is waited for or kept from starting until the end.
+func (s *Service) DeletePlayerData(username string) (domain.Erasure, error) {
+	if username == "" {
+		return domain.Erasure{}, errors.New("username is required")
+	}
+	if s.erasures == nil {
+		return domain.Erasure{}, ErrNoErasureLog
+	}
+
+	s.erasing.Lock()
+	defer s.erasing.Unlock()
+
+	if s.deadLetters != nil {
+		unlock, err := s.deadLetters.Lock()
+		if err != nil {
+			return domain.Erasure{}, err
+		}
+		defer unlock()
+	}
+
+	subject := sha256.Sum256([]byte(username))
+	erasure := domain.Erasure{
+		ID:          uuid.NewString(),
+		Subject:     hex.EncodeToString(subject[:]),
+		RequestedAt: time.Now().UTC(),
+	}
+
+	var errs []error
+	erase := func(store string, deletePlayerData func() (int64, error)) {
+		startTime := time.Now()
+		deleted, err := deletePlayerData()
+
+		result := domain.ErasureStore{
+			Backend: store,
+			Deleted: deleted,
+			TookMs:  float64(time.Since(startTime)) / float64(time.Millisecond),
+		}
+		if err != nil {
+			log.Printf("[%s] erasure %s error: %v", store, erasure.ID, err)
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", store, err))
+		}
+		erasure.Stores = append(erasure.Stores, result)
+	}
+
+	for _, backend := range s.Backends() {
+		erase(backend, func() (int64, error) {
+			switch backend {
+			case BackendPostgres:
+				return s.postgres.DeletePlayerData(username)
+			case BackendMongo:
+				return s.mongo.DeletePlayerData("reports", username)
+			default:
+				return s.click.DeletePlayerData(username)
+			}
+		})
+	}
+	if s.deadLetters != nil {
+		erase("dead_letters", func() (int64, error) {
+			return s.deadLetters.DeletePlayerData(username)
+		})
+	}
+	erasure.FinishedAt = time.Now().UTC()
+
+	if err := s.erasures.Put(erasure); err != nil {
+		errs = append(errs, fmt.Errorf("erasure audit error: %w", err))
+	}
+
+	return erasure, errors.Join(errs...)
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+// outboxPostgres keeps outbox entries in memory, the rest of the port is left nil.
+type outboxPostgres struct {
+	app.PostgresRepository
+
+	mu      sync.Mutex
+	entries []domain.OutboxEntry
+}
+
+func (r *outboxPostgres) ReadOutbox(target string, limit int) ([]domain.OutboxEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]domain.OutboxEntry(nil), r.entries[:min(limit, len(r.entries))]...), nil
+}
+
+func (r *outboxPostgres) AckOutbox(target string, entryID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, entry := range r.entries {
+		if entry.ID == entryID {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *outboxPostgres) OutboxBacklog(target string) (int64, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.entries)), time.Time{}, nil
+}
+
+func (r *outboxPostgres) DeletePlayerData(username string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for i, entry := range r.entries {
+		kept := entry.Reports[:0:0]
+		for _, report := range entry.Reports {
+			if report.Username == username {
+				deleted++
+			} else {
+				kept = append(kept, report)
+			}
+		}
+		r.entries[i].Reports = kept
+	}
+	return deleted, nil
+}
+
+// slowMongo stores reports in memory, each insert waits for release once it started.
+type slowMongo struct {
+	app.MongoRepository
+
+	inserting chan struct{}
+	release   chan struct{}
+
+	mu      sync.Mutex
+	reports map[string]domain.Report
+}
+
+func (r *slowMongo) InsertReports(collection string, reports []domain.Report, opts app.MongoWriteOptions) (int64, error) {
+	r.inserting <- struct{}{}
+	<-r.release
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, report := range reports {
+		r.reports[report.TransactionID] = report
+	}
+	return int64(len(reports)), nil
+}
+
+func (r *slowMongo) DeletePlayerData(collection, username string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, report := range r.reports {
+		if report.Username == username {
+			delete(r.reports, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type memoryErasureLog struct {
+	erasures []domain.Erasure
+}
+
+func (l *memoryErasureLog) Put(erasure domain.Erasure) error {
+	l.erasures = append(l.erasures, erasure)
+	return nil
+}
+
+func TestDeletePlayerDataWaitsForRelayDelivery(t *testing.T) {
+	pg := &outboxPostgres{entries: []domain.OutboxEntry{{
+		ID:      1,
+		Reports: []domain.Report{{Username: "player", TransactionID: "tx1"}, {Username: "other", TransactionID: "tx2"}},
+	}}}
+	mongo := &slowMongo{
+		inserting: make(chan struct{}, 1),
+		release:   make(chan struct{}),
+		reports:   make(map[string]domain.Report),
+	}
+
+	svc := NewService(pg, mongo, nil)
+	if err := svc.EnableOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	svc.SetErasureLog(&memoryErasureLog{})
+
+	relay := NewRelay(svc, RelayConfig{
+		BatchSize:    10,
+		PollInterval: 10 * time.Millisecond,
+		MinBackoff:   10 * time.Millisecond,
+		MaxBackoff:   10 * time.Millisecond,
+		PruneEvery:   time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		relay.Run(ctx)
+	}()
+	release := sync.OnceFunc(func() { close(mongo.release) })
+	defer func() {
+		release() // a failed test mustn't leave the relay stuck in the insert
+		cancel()
+		<-stopped
+	}()
+
+	// the relay has read the entry and is writing it to Mongo
+	<-mongo.inserting
+
+	erased := make(chan error, 1)
+	go func() {
+		_, err := svc.DeletePlayerData("player")
+		erased <- err
+	}()
+
+	select {
+	case err := <-erased:
+		t.Fatalf("deletion finished while the relay was delivering, err %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	if err := <-erased; err != nil {
+		t.Fatal(err)
+	}
+
+	mongo.mu.Lock()
+	defer mongo.mu.Unlock()
+	if _, ok := mongo.reports["tx1"]; ok {
+		t.Error("the player's report was written back after the deletion")
+	}
+	if _, ok := mongo.reports["tx2"]; !ok {
+		t.Error("the other player's report wasn't delivered")
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"time"
+)
+
+const recentReports = 10_000
+
+// Faults injects the irregularities of production feeds into generated data.
+// The zero value injects nothing and leaves the generated stream unchanged.
+type Faults struct {
+	DuplicateRate float64       `json:"duplicate_rate"` // fraction of reports that replay one of the last 10000 transactions
+	LateRate      float64       `json:"late_rate"`      // fraction of reports settled late, with a bet time before the profile window
+	LateBy        time.Duration `json:"-"`              // how far before the window late bets fall, at least a second, defaults to 30 days; late_by in JSON, like "720h"
+	OutOfOrder    float64       `json:"out_of_order"`   // fraction of batches held back and delivered after later batches
+	ReorderWindow int           `json:"reorder_window"` // how many batches a held back batch may be overtaken by, defaults to 10
+}
+
+func (f Faults) Enabled() bool {
+	return f.DuplicateRate > 0 || f.LateRate > 0 || f.OutOfOrder > 0
+}
+
+func (f Faults) MarshalJSON() ([]byte, error) {
+	type faults Faults
+	var lateBy string
+	if f.LateBy != 0 {
+		lateBy = f.LateBy.String()
+	}
+	return json.Marshal(struct {
+		faults
+		LateBy string `json:"late_by,omitempty"`
+	}{faults(f), lateBy})
+}
+
+// UnmarshalJSON reads late_by with time.ParseDuration.
+func (f *Faults) UnmarshalJSON(data []byte) error {
+	type faults Faults
+	v := struct {
+		faults
+		LateBy string `json:"late_by"`
+	}{faults: faults(*f)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*f = Faults(v.faults)
+	if v.LateBy != "" {
+		lateBy, err := time.ParseDuration(v.LateBy)
+		if err != nil {
+			return fmt.Errorf("invalid late_by: %w", err)
+		}
+		f.LateBy = lateBy
+	}
+	return nil
+}
+
+// GeneratorStats counts what was generated, so what each backend stored can be checked against it.
+type GeneratorStats struct {
+	Rows          int64 // reports emitted, duplicates included
+	Duplicates    int64 // replayed transactions
+	Late          int64 // reports with a late bet time
+	Reordered     int64 // batches delivered out of order
+	Winloss       int64 // winloss over all emitted reports
+	UniqueWinloss int64 // winloss counting each transaction once
+}
+
+func (s GeneratorStats) UniqueRows() int64 {
+	return s.Rows - s.Duplicates
+}
+
+// Stats returns the counters for everything generated so far. Read it after the
+// stream from Batches is drained.
+func (g *Generator) Stats() GeneratorStats {
+	return g.stats
+}
+
+func (g *Generator) duplicate() (domain.Report, bool) {
+	f := g.cfg.Faults
+	if f.DuplicateRate <= 0 || len(g.recent) == 0 || g.rnd.Float64() >= f.DuplicateRate {
+		return domain.Report{}, false
+	}
+
+	dup := g.recent[g.rnd.Intn(len(g.recent))]
+	g.stats.Rows++
+	g.stats.Duplicates++
+	g.stats.Winloss += dup.Winloss
+
+	return dup, true
+}
+
+func (g *Generator) late(report *domain.Report) {
+	f := g.cfg.Faults
+	if f.LateRate <= 0 || g.rnd.Float64() >= f.LateRate {
+		return
+	}
+
+	lateBy := f.LateBy
+	if lateBy <= 0 {
+		lateBy = 30 * 24 * time.Hour
+	}
+
+	windowStart := g.cfg.ReferenceTime.Add(-g.cfg.Profile.Window)
+	report.BetTime = windowStart.Add(-time.Duration(g.rnd.Int63n(int64(lateBy/time.Second))+1) * time.Second)
+	g.stats.Late++
+}
+
+func (g *Generator) remember(report domain.Report) {
+	g.stats.Rows++
+	g.stats.Winloss += report.Winloss
+	g.stats.UniqueWinloss += report.Winloss
+
+	if g.cfg.Faults.DuplicateRate <= 0 {
+		return
+	}
+	if len(g.recent) < recentReports {
+		g.recent = append(g.recent, report)
+		return
+	}
+	g.recent[g.recentPos] = report
+	g.recentPos = (g.recentPos + 1) % recentReports
+}
+
+type heldBatch struct {
+	batch []domain.Report
+	delay int // batches left to deliver before this one
+}
+
+// reorder holds batch back when it's picked to arrive out of order and returns the
+// batches that are due now, in delivery order.
+func (g *Generator) reorder(held []heldBatch, batch []domain.Report) ([]heldBatch, [][]domain.Report) {
+	f := g.cfg.Faults
+	if f.OutOfOrder <= 0 {
+		return held, [][]domain.Report{batch}
+	}
+
+	window := f.ReorderWindow
+	if window <= 0 {
+		window = 10
+	}
+
+	if g.rnd.Float64() < f.OutOfOrder {
+		g.stats.Reordered++
+		return append(held, heldBatch{batch: batch, delay: 1 + g.rnd.Intn(window)}), nil
+	}
+
+	ready := [][]domain.Report{batch}
+	kept := held[:0]
+	for _, h := range held {
+		h.delay--
+		if h.delay <= 0 {
+			ready = append(ready, h.batch)
+			continue
+		}
+		kept = append(kept, h)
+	}
+
+	return kept, ready
+}
+
+// FaultReport compares what one backend stored with what the generator produced.
+type FaultReport struct {
+	Backend        string
+	Count          int64
+	Winloss        int64
+	ExpectedRows   int64 // every emitted report, duplicates included
+	UniqueRows     int64 // each transaction once
+	ExpectedSum    int64
+	UniqueSum      int64
+	DuplicatesKept int64 // rows stored beyond the unique transactions
+}
+
+func (r FaultReport) String() string {
+	return fmt.Sprintf("[%s] Count: %d (emitted %d, unique %d, duplicates kept %d) | Winloss: %d (emitted %d, unique %d)",
+		r.Backend, r.Count, r.ExpectedRows, r.UniqueRows, r.DuplicatesKept, r.Winloss, r.ExpectedSum, r.UniqueSum)
+}
+
+// FaultReports counts and sums the reports stored by every backend and compares them with stats.
+func (s *Service) FaultReports(stats GeneratorStats) ([]FaultReport, error) {
+	var (
+		reports []FaultReport
+		errs    []error
+	)
+
+	add := func(backend string, count int64, profits []domain.ProfitAggregationResult) {
+		var sum int64
+		for _, p := range profits {
+			sum += p.TotalProfit
+		}
+		reports = append(reports, FaultReport{
+			Backend:        backend,
+			Count:          count,
+			Winloss:        sum,
+			ExpectedRows:   stats.Rows,
+			UniqueRows:     stats.UniqueRows(),
+			ExpectedSum:    stats.Winloss,
+			UniqueSum:      stats.UniqueWinloss,
+			DuplicatesKept: count - stats.UniqueRows(),
+		})
+	}
+
+	if s.postgres != nil {
+		_, count, err := s.postgres.CountReports()
+		_, profits, err2 := s.postgres.QueryReport()
+		if err := errors.Join(err, err2); err != nil {
+			errs = append(errs, fmt.Errorf("Postgres fault report error: %w", err))
+		} else {
+			add("PostgreSQL", count, profits)
+		}
+	}
+
+	if s.mongo != nil {
+		_, count, err := s.mongo.CountReportsWhere("reports", domain.ReportFilter{})
+		_, profits, err2 := s.mongo.AggregationReports("reports")
+		if err := errors.Join(err, err2); err != nil {
+			errs = append(errs, fmt.Errorf("MongoDB fault report error: %w", err))
+		} else {
+			add("MongoDB", count, profits)
+		}
+	}
+
+	if s.click != nil {
+		_, count, err := s.click.CountReports()
+		_, profits, err2 := s.click.QueryReport()
+		if err := errors.Join(err, err2); err != nil {
+			errs = append(errs, fmt.Errorf("ClickHouse fault report error: %w", err))
+		} else {
+			add("ClickHouse", count, profits)
+		}
+	}
+
+	return reports, errors.Join(errs...)
+}
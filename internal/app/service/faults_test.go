@@ -0,0 +1,36 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFaultsJSON(t *testing.T) {
+	var f Faults
+	if err := json.Unmarshal([]byte(`{"late_rate": 0.01, "late_by": "36h30m", "reorder_window": 5}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	want := Faults{LateRate: 0.01, LateBy: 36*time.Hour + 30*time.Minute, ReorderWindow: 5}
+	if f != want {
+		t.Fatalf("got %+v, want %+v", f, want)
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Faults
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back != f {
+		t.Fatalf("%s read back as %+v", data, back)
+	}
+
+	for _, invalid := range []string{`{"late_by": "30 days"}`, `{"late_by": 3600}`} {
+		if err := json.Unmarshal([]byte(invalid), &f); err == nil {
+			t.Errorf("accepted %s", invalid)
+		}
+	}
+}
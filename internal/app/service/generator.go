@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultSeed int64 = 42
+
+// DefaultReferenceTime is the fixed "now" all generated bet times are anchored on,
+// so datasets don't depend on the wall clock of the machine that generated them.
+var DefaultReferenceTime = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type GeneratorConfig struct {
+	Seed          int64
+	ReferenceTime time.Time
+	Profile       Profile
+	Catalog       *domain.Catalog // nil builds NewCatalog(Profile.Brands, Profile.Games)
+	Faults        Faults
+	IDPrefix      string // prepended to transaction ids, so runs of the same seed don't collide
+}
+
+// Profile describes the shape of the generated data.
+type Profile struct {
+	Users    int     // distinct players, 0 means a new player for every report
+	UserSkew float64 // zipf exponent for picking players, must be > 1 to take effect
+	Brands   int     // catalog size, ignored when GeneratorConfig.Catalog is set
+	Games    int     // catalog size, ignored when GeneratorConfig.Catalog is set
+	GameSkew float64 // zipf exponent for picking games, must be > 1 to take effect
+
+	BetMedian float64 // median of the log-normal bet size, 0 keeps bets uniform over 0-10000
+	BetSigma  float64 // spread of the log-normal bet size
+	MaxBet    int64
+
+	Window      time.Duration // bet times fall in [ReferenceTime-Window, ReferenceTime)
+	Seasonality bool          // weight bet times by hour of day and day of week
+}
+
+// UniformProfile draws every field uniformly, one new player per report.
+func UniformProfile() Profile {
+	return Profile{
+		Brands: 10,
+		Games:  100,
+		Window: 100000 * time.Minute,
+	}
+}
+
+// RealisticProfile models skewed traffic: a few heavy players and hit games,
+// log-normal bet sizes and evening and weekend peaks.
+func RealisticProfile() Profile {
+	return Profile{
+		Users:       100_000,
+		UserSkew:    1.1,
+		Brands:      10,
+		Games:       100,
+		GameSkew:    1.3,
+		BetMedian:   50,
+		BetSigma:    1.5,
+		MaxBet:      1_000_000,
+		Window:      90 * 24 * time.Hour,
+		Seasonality: true,
+	}
+}
+
+func DefaultGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		Seed:          DefaultSeed,
+		ReferenceTime: DefaultReferenceTime,
+		Profile:       UniformProfile(),
+	}
+}
+
+// hourWeights is the relative traffic per hour of day, peaking in the evening.
+var hourWeights = [24]float64{
+	4, 3, 2, 1.5, 1, 1, 1.5, 2, 3, 4, 5, 6,
+	6, 6, 6, 6.5, 7, 8, 9, 10, 10, 9, 7, 5,
+}
+
+// weekdayWeights is the relative traffic per day of week, starting on Sunday.
+var weekdayWeights = [7]float64{1.3, 0.9, 0.85, 0.9, 0.95, 1.2, 1.4}
+
+// Generator produces reports from a single seeded random source. The same config and
+// the same sequence of calls always yield the same reports. A Generator is not safe
+// for concurrent use, see Batches.
+type Generator struct {
+	cfg GeneratorConfig
+	rnd *rand.Rand
+	seq int64
+
+	catalog    domain.Catalog
+	users      []string
+	userZipf   *rand.Zipf
+	gameZipf   *rand.Zipf
+	hourCumSum [24]float64
+
+	recent    []domain.Report // ring of recent reports duplicates are replayed from
+	recentPos int
+	stats     GeneratorStats
+}
+
+// Validate rejects configs the generator can't draw from. Zero values are defaults and pass.
+func (cfg GeneratorConfig) Validate() error {
+	switch {
+	case cfg.Profile.Window > 0 && cfg.Profile.Window < time.Minute:
+		return fmt.Errorf("profile window %s is shorter than a minute", cfg.Profile.Window)
+	case cfg.Catalog != nil && len(cfg.Catalog.Brands) == 0:
+		return errors.New("catalog has no brands")
+	case cfg.Catalog != nil && len(cfg.Catalog.Games) == 0:
+		return errors.New("catalog has no games")
+	case cfg.Faults.LateBy > 0 && cfg.Faults.LateBy < time.Second:
+		return fmt.Errorf("late by %s is shorter than a second", cfg.Faults.LateBy)
+	case !isRate(cfg.Faults.DuplicateRate):
+		return fmt.Errorf("duplicate rate %v is outside [0, 1]", cfg.Faults.DuplicateRate)
+	case !isRate(cfg.Faults.LateRate):
+		return fmt.Errorf("late rate %v is outside [0, 1]", cfg.Faults.LateRate)
+	case !isRate(cfg.Faults.OutOfOrder):
+		return fmt.Errorf("out of order rate %v is outside [0, 1]", cfg.Faults.OutOfOrder)
+	}
+	return nil
+}
+
+// isRate is false for NaN too.
+func isRate(f float64) bool {
+	return f >= 0 && f <= 1
+}
+
+func NewGenerator(cfg GeneratorConfig) (*Generator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("generator config error: %w", err)
+	}
+	if cfg.ReferenceTime.IsZero() {
+		cfg.ReferenceTime = DefaultReferenceTime
+	}
+	cfg.ReferenceTime = cfg.ReferenceTime.UTC().Truncate(time.Second)
+
+	p := &cfg.Profile
+	if p.Brands <= 0 {
+		p.Brands = 10
+	}
+	if p.Games <= 0 {
+		p.Games = 100
+	}
+	if p.Window <= 0 {
+		p.Window = 100000 * time.Minute
+	}
+	if p.MaxBet <= 0 {
+		p.MaxBet = math.MaxInt32
+	}
+
+	catalog := NewCatalog(p.Brands, p.Games)
+	if cfg.Catalog != nil {
+		catalog = *cfg.Catalog
+	}
+
+	g := &Generator{
+		cfg:     cfg,
+		rnd:     rand.New(rand.NewSource(cfg.Seed)),
+		catalog: catalog,
+	}
+
+	if p.Users > 0 {
+		// the player pool has its own source so its size doesn't shift the report stream
+		poolRnd := rand.New(rand.NewSource(cfg.Seed ^ 0x5eed))
+		g.users = make([]string, p.Users)
+		for i := range g.users {
+			g.users[i] = uuid.Must(uuid.NewRandomFromReader(poolRnd)).String()
+		}
+		if p.UserSkew > 1 && p.Users > 1 {
+			g.userZipf = rand.NewZipf(g.rnd, p.UserSkew, 1, uint64(p.Users-1))
+		}
+	}
+	if p.GameSkew > 1 && len(catalog.Games) > 1 {
+		g.gameZipf = rand.NewZipf(g.rnd, p.GameSkew, 1, uint64(len(catalog.Games)-1))
+	}
+
+	var sum float64
+	for h, w := range hourWeights {
+		sum += w
+		g.hourCumSum[h] = sum
+	}
+
+	return g, nil
+}
+
+func (g *Generator) Config() GeneratorConfig {
+	return g.cfg
+}
+
+// Catalog returns the dimensions the generator draws brands and games from.
+func (g *Generator) Catalog() domain.Catalog {
+	return g.catalog
+}
+
+func (g *Generator) Generate(count int) []domain.Report {
+	reports := make([]domain.Report, count)
+	for i := range reports {
+		reports[i] = g.next()
+	}
+	return reports
+}
+
+// Batches streams total reports in slices of batchSize. Generation runs ahead of the
+// consumer by at most one buffered batch, so memory stays bounded by the batch size
+// no matter how many reports are requested. The channel is closed once all reports
+// were sent or ctx is done. The generator belongs to the goroutine filling the channel
+// until then: calling any other method, Stats and Generate included, before the channel
+// is closed races with it. A batchSize below one yields no batches: the channel is closed
+// right away.
+func (g *Generator) Batches(ctx context.Context, total, batchSize int) <-chan []domain.Report {
+	out := make(chan []domain.Report, 1)
+	if batchSize <= 0 {
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+
+		var held []heldBatch
+		for sent := 0; sent < total; sent += batchSize {
+			batch := g.Generate(min(batchSize, total-sent))
+
+			var ready [][]domain.Report
+			held, ready = g.reorder(held, batch)
+
+			for _, b := range ready {
+				select {
+				case out <- b:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		for _, h := range held {
+			select {
+			case out <- h.batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func (g *Generator) next() domain.Report {
+	if dup, ok := g.duplicate(); ok {
+		return dup
+	}
+
+	report := g.newReport()
+	g.late(&report)
+	g.remember(report)
+
+	return report
+}
+
+func (g *Generator) newReport() domain.Report {
+	r := g.rnd
+
+	g.seq++
+
+	username := g.username()
+	game := g.catalog.Games[g.pick(g.gameZipf, len(g.catalog.Games))]
+	brand := g.catalog.Brands[r.Intn(len(g.catalog.Brands))]
+
+	bet, turnover, winloss := g.amounts()
+
+	return domain.Report{
+		Username:      username,
+		UsernameGame:  fmt.Sprintf("%s_%s", username, game.ProviderID),
+		Currency:      "USD",
+		Winloss:       winloss,
+		Bet:           bet,
+		Turnover:      turnover,
+		Payout:        r.Float64() * 100,
+		BetTime:       g.betTime(),
+		BrandID:       brand.ID,
+		BrandName:     brand.Name,
+		GameID:        game.ID,
+		GameName:      game.Name,
+		GameType:      game.Type,
+		TransactionID: fmt.Sprintf("%stx%d_%d", g.cfg.IDPrefix, g.cfg.Seed, g.seq), // sequence based, never collides within a seed
+		RoundID:       fmt.Sprintf("round%d", r.Int63()),
+		Status:        domain.Settled,
+		Version:       1,
+	}
+}
+
+func (g *Generator) username() string {
+	if len(g.users) == 0 {
+		// reading from the seeded source keeps usernames reproducible, unlike uuid.NewString()
+		return uuid.Must(uuid.NewRandomFromReader(g.rnd)).String()
+	}
+	return g.users[g.pick(g.userZipf, len(g.users))]
+}
+
+// pick returns an index in [0, n), zipf distributed when z is set and uniform otherwise.
+func (g *Generator) pick(z *rand.Zipf, n int) int {
+	if z != nil {
+		return int(z.Uint64())
+	}
+	return g.rnd.Intn(n)
+}
+
+func (g *Generator) amounts() (bet, turnover, winloss int64) {
+	r := g.rnd
+	p := g.cfg.Profile
+
+	if p.BetMedian <= 0 {
+		winloss = r.Int63n(10000) - 5000
+		bet = r.Int63n(10000)
+		turnover = r.Int63n(20000)
+		return bet, turnover, winloss
+	}
+
+	bet = int64(math.Exp(math.Log(p.BetMedian) + p.BetSigma*r.NormFloat64()))
+	bet = max(1, min(bet, p.MaxBet))
+	turnover = bet
+	// player result between losing the stake and doubling it, slightly in favour of the house
+	winloss = int64(float64(bet) * (r.Float64()*2 - 1.04))
+
+	return bet, turnover, winloss
+}
+
+func (g *Generator) betTime() time.Time {
+	r := g.rnd
+	p := g.cfg.Profile
+	ref := g.cfg.ReferenceTime
+
+	if !p.Seasonality {
+		return ref.Add(-time.Duration(r.Int63n(int64(p.Window/time.Minute))) * time.Minute)
+	}
+
+	days := max(1, int(p.Window/(24*time.Hour)))
+	start := ref.Truncate(24*time.Hour).AddDate(0, 0, -days)
+
+	var day time.Time
+	for {
+		day = start.AddDate(0, 0, r.Intn(days))
+		// rejection sampling against the busiest weekday
+		if r.Float64()*1.4 < weekdayWeights[day.Weekday()] {
+			break
+		}
+	}
+
+	x := r.Float64() * g.hourCumSum[23]
+	hour := 0
+	for x >= g.hourCumSum[hour] {
+		hour++
+	}
+
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(r.Intn(3600))*time.Second)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"hexgonaldb/internal/domain"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGeneratorSameSeedSameReports(t *testing.T) {
+	configs := map[string]GeneratorConfig{
+		"uniform": DefaultGeneratorConfig(),
+		"realistic": {
+			Seed:    DefaultSeed,
+			Profile: RealisticProfile(),
+			Faults:  Faults{DuplicateRate: 0.05, LateRate: 0.05, OutOfOrder: 0.2},
+		},
+	}
+
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			a := generate(t, cfg)
+			b := generate(t, cfg)
+			if len(a) != 5000 {
+				t.Fatalf("got %d reports, want 5000", len(a))
+			}
+			for i := range a {
+				if !reflect.DeepEqual(a[i], b[i]) {
+					t.Fatalf("report %d differs between runs:\n%+v\n%+v", i, a[i], b[i])
+				}
+			}
+
+			cfg.Seed++
+			if reflect.DeepEqual(a, generate(t, cfg)) {
+				t.Fatal("another seed generated the same reports")
+			}
+		})
+	}
+}
+
+// generate collects the reports of Batches, so reordered batches are covered too.
+func generate(t *testing.T, cfg GeneratorConfig) []domain.Report {
+	t.Helper()
+
+	g, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []domain.Report
+	for batch := range g.Batches(context.Background(), 5000, 100) {
+		reports = append(reports, batch...)
+	}
+	return reports
+}
+
+func TestGeneratorBatchesRejectsEmptyBatches(t *testing.T) {
+	g, err := NewGenerator(DefaultGeneratorConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, batchSize := range []int{0, -1} {
+		select {
+		case batch, ok := <-g.Batches(context.Background(), 10, batchSize):
+			if ok {
+				t.Fatalf("batch size %d yielded a batch of %d reports", batchSize, len(batch))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("batch size %d didn't close the channel", batchSize)
+		}
+	}
+}
+
+func TestGeneratorConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		faults  Faults
+		wantErr bool
+	}{
+		{name: "zero"},
+		{name: "bounds", faults: Faults{DuplicateRate: 1, LateRate: 0, OutOfOrder: 1}},
+		{name: "negative duplicate rate", faults: Faults{DuplicateRate: -0.1}, wantErr: true},
+		{name: "late rate above one", faults: Faults{LateRate: 1.5}, wantErr: true},
+		{name: "out of order above one", faults: Faults{OutOfOrder: 2}, wantErr: true},
+		{name: "NaN rate", faults: Faults{DuplicateRate: math.NaN()}, wantErr: true},
+		{name: "late by under a second", faults: Faults{LateBy: time.Millisecond}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultGeneratorConfig()
+			cfg.Faults = tt.faults
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
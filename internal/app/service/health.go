@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app"
+	"sync"
+	"time"
+)
+
+// BackendStatus is the outcome of pinging one backend.
+type BackendStatus struct {
+	Backend string  `json:"backend"`
+	Ready   bool    `json:"ready"`
+	TookMs  float64 `json:"took_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func (s *Service) lifecycle(backend string) app.Lifecycle {
+	switch backend {
+	case BackendPostgres:
+		return s.postgres
+	case BackendMongo:
+		return s.mongo
+	case BackendClickHouse:
+		return s.click
+	}
+	return nil
+}
+
+// Ping pings every configured backend in parallel, each one bounded by timeout.
+func (s *Service) Ping(ctx context.Context, timeout time.Duration) []BackendStatus {
+	backends := s.Backends()
+	statuses := make([]BackendStatus, len(backends))
+
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			startTime := time.Now()
+			err := s.lifecycle(backend).Ping(pingCtx)
+
+			statuses[i] = BackendStatus{
+				Backend: backend,
+				Ready:   err == nil,
+				TookMs:  float64(time.Since(startTime)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				statuses[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// Close closes the clients of every configured backend.
+func (s *Service) Close() error {
+	var errs []error
+	for _, backend := range s.Backends() {
+		if err := s.lifecycle(backend).Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s error: %w", backend, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/app"
+	"hexgonaldb/internal/domain"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	BackendPostgres   = "postgres"
+	BackendMongo      = "mongo"
+	BackendClickHouse = "clickhouse"
+
+	PostgresInsert     = "insert"      // multi-row INSERT built by GORM
+	PostgresCopy       = "copy"        // COPY protocol through pgx, into a staging table merged with ON CONFLICT
+	PostgresCopyDirect = "copy_direct" // COPY straight into reports, a stored transaction id fails the batch
+)
+
+// WriteOptions picks how batches are written. They're part of benchmark scenarios so
+// results say which strategy they measured.
+type WriteOptions struct {
+	PostgresMethod string                     `json:"postgres_method"` // insert (default), copy or copy_direct
+	Mongo          app.MongoWriteOptions      `json:"mongo"`
+	Clickhouse     app.ClickhouseWriteOptions `json:"clickhouse"`
+}
+
+func (o *WriteOptions) normalize() error {
+	switch o.PostgresMethod {
+	case "":
+		o.PostgresMethod = PostgresInsert
+	case PostgresInsert, PostgresCopy, PostgresCopyDirect:
+	default:
+		return fmt.Errorf("unknown postgres method %q, use insert, copy or copy_direct", o.PostgresMethod)
+	}
+
+	if w := o.Mongo.W; w != "" && w != "majority" {
+		if n, err := strconv.Atoi(w); err != nil || n < 0 {
+			return fmt.Errorf("invalid mongo w %q, use a number or majority", w)
+		}
+	}
+	if o.Mongo.W == "0" && o.Mongo.Journal {
+		return errors.New("mongo j needs an acknowledged write concern, w can't be 0")
+	}
+
+	switch o.Clickhouse.Append {
+	case "":
+		o.Clickhouse.Append = "row"
+	case "row", "column":
+	default:
+		return fmt.Errorf("unknown clickhouse append mode %q, use row or column", o.Clickhouse.Append)
+	}
+	switch o.Clickhouse.AsyncInsert {
+	case "", "wait", "nowait":
+	default:
+		return fmt.Errorf("unknown clickhouse async insert mode %q, use wait or nowait", o.Clickhouse.AsyncInsert)
+	}
+	switch o.Clickhouse.Compression {
+	case "":
+		o.Clickhouse.Compression = "lz4"
+	case "lz4", "zstd", "none":
+	default:
+		return fmt.Errorf("unknown clickhouse compression %q, use lz4, zstd or none", o.Clickhouse.Compression)
+	}
+	return nil
+}
+
+// SetWriteOptions sets how WriteReports and WriteReportsTo write batches.
+func (s *Service) SetWriteOptions(o WriteOptions) error {
+	if err := o.normalize(); err != nil {
+		return err
+	}
+	s.writeOptions = o
+	return nil
+}
+
+// WriteOptions returns the options batches are written with.
+func (s *Service) WriteOptions() WriteOptions {
+	o := s.writeOptions
+	o.normalize()
+	return o
+}
+
+// BackendResult is the outcome of writing one batch to one backend.
+// What the duplicates of a backend count, see DuplicateScope.
+const (
+	DuplicatesStored  = "stored"   // repeats of stored transaction ids and within the batch
+	DuplicatesInBatch = "in_batch" // repeats within the batch only
+)
+
+// DuplicateScope returns what the duplicates reported by backend count. ClickHouse doesn't
+// look up stored ids before inserting, it inserts their repeats and collapses them on merge.
+func DuplicateScope(backend string) string {
+	if backend == BackendClickHouse {
+		return DuplicatesInBatch
+	}
+	return DuplicatesStored
+}
+
+type BackendResult struct {
+	Backend         string        `json:"backend"`
+	Success         bool          `json:"success"`
+	Rows            int           `json:"rows"`                   // rows inserted
+	Duplicates      int           `json:"duplicates"`             // rows skipped as already stored, as far as DuplicatesScope goes
+	DuplicatesScope string        `json:"duplicates_scope"`       // what Duplicates counts, DuplicatesStored or DuplicatesInBatch
+	Unattributed    int           `json:"unattributed,omitempty"` // rows a write buffer flushed with other writes', inserted or skipped, in neither count
+	Attempts        int           `json:"attempts"`
+	Took            time.Duration `json:"-"`
+	Error           string        `json:"error,omitempty"`
+	DeadLettered    bool          `json:"dead_lettered,omitempty"` // failed for good and kept in the dead-letter store
+}
+
+func (r BackendResult) MarshalJSON() ([]byte, error) {
+	type result BackendResult
+	return json.Marshal(struct {
+		result
+		TookMs float64 `json:"took_ms"`
+	}{result(r), float64(r.Took) / float64(time.Millisecond)})
+}
+
+// Backends returns the names of the configured backends.
+func (s *Service) Backends() []string {
+	var backends []string
+	if s.postgres != nil {
+		backends = append(backends, BackendPostgres)
+	}
+	if s.mongo != nil {
+		backends = append(backends, BackendMongo)
+	}
+	if s.click != nil {
+		backends = append(backends, BackendClickHouse)
+	}
+	return backends
+}
+
+// WriteReports writes the batch to every configured backend, one after the other so the
+// timing of one backend isn't skewed by another loading the machine. A failing backend
+// doesn't stop the others, the outcome of each is returned in Backends() order. Writes
+// are idempotent on TransactionID, reports already stored are counted as duplicates.
+//
+// With the outbox enabled only Postgres is written, together with an outbox entry, and the
+// single result is Postgres'; the other backends catch up through the Relay.
+func (s *Service) WriteReports(ctx context.Context, reports []domain.Report) []BackendResult {
+	if s.outbox {
+		return []BackendResult{s.WriteOutbox(ctx, reports)}
+	}
+	return s.WriteReportsTo(ctx, s.Backends(), reports)
+}
+
+// WriteReportsTo is WriteReports limited to the given backends.
+func (s *Service) WriteReportsTo(ctx context.Context, backends []string, reports []domain.Report) []BackendResult {
+	return s.WriteReportsWith(ctx, backends, reports, s.WriteOptions())
+}
+
+// WriteReportsWith is WriteReportsTo with its own write options, they must be valid.
+func (s *Service) WriteReportsWith(ctx context.Context, backends []string, reports []domain.Report, opts WriteOptions) []BackendResult {
+	results := make([]BackendResult, len(backends))
+
+	for i, backend := range backends {
+		results[i] = s.writeBackend(ctx, backend, reports, opts)
+	}
+
+	return results
+}
+
+// writeBackend writes the batch to one backend, retrying by the backend's RetryPolicy. A
+// batch that still fails goes to the dead-letter store, unless ctx was canceled before it
+// was tried at all.
+func (s *Service) writeBackend(ctx context.Context, backend string, reports []domain.Report, opts WriteOptions) BackendResult {
+	reports = withDefaults(reports)
+
+	err := s.checkBackend(backend)
+	if err == nil {
+		err = ctx.Err()
+	}
+	return s.writeRetrying(ctx, backend, backend, reports, err, func() (int64, error) {
+		return s.insert(backend, reports, opts)
+	})
+}
+
+// writeRetrying runs insert by the backend's RetryPolicy, unless err says the batch can't be
+// tried at all, and dead-letters the batch under letterBackend when it still fails.
+func (s *Service) writeRetrying(ctx context.Context, backend, letterBackend string, reports []domain.Report, err error, insert func() (int64, error)) BackendResult {
+	startTime := time.Now()
+	policy := s.retryPolicy(backend)
+
+	var (
+		inserted int64
+		attempts int
+	)
+	for err == nil {
+		attempts++
+		inserted, err = insert()
+		if err == nil || attempts >= policy.MaxAttempts || !policy.retryable(err) {
+			break
+		}
+
+		delay := policy.delay(attempts)
+		log.Printf("[%s] write attempt %d failed, retrying in %s: %v", letterBackend, attempts, delay, err)
+		if !sleep(ctx, delay) {
+			break // shutting down, the batch is dead-lettered with the last error
+		}
+		err = nil
+	}
+
+	result := BackendResult{
+		Backend:         backend,
+		DuplicatesScope: DuplicateScope(backend),
+		Success:         err == nil,
+		Attempts:        attempts,
+		Took:            time.Since(startTime),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		if attempts > 0 {
+			result.DeadLettered = s.deadLetter(letterBackend, reports, err, attempts)
+		}
+	} else if inserted == InsertedUnknown {
+		result.Unattributed = len(reports)
+	} else {
+		result.Rows = int(inserted)
+		result.Duplicates = len(reports) - int(inserted)
+	}
+
+	return result
+}
+
+func (s *Service) insert(backend string, reports []domain.Report, opts WriteOptions) (int64, error) {
+	switch backend {
+	case BackendPostgres:
+		switch opts.PostgresMethod {
+		case PostgresCopy:
+			return s.postgres.CopyReports(reports)
+		case PostgresCopyDirect:
+			return s.postgres.CopyReportsDirect(reports)
+		}
+		return s.postgres.CreateManyReports(reports)
+	case BackendMongo:
+		return s.mongo.InsertReports("reports", reports, opts.Mongo)
+	default:
+		return s.click.InsertReports(reports, opts.Clickhouse)
+	}
+}
+
+func (s *Service) deadLetter(backend string, reports []domain.Report, err error, attempts int) bool {
+	if s.deadLetters == nil {
+		return false
+	}
+
+	letter := domain.DeadLetter{
+		Backend:  backend,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+		Reports:  reports,
+	}
+	if err := s.deadLetters.Put(letter); err != nil {
+		log.Printf("[%s] dead letter error, %d reports lost: %v", backend, len(reports), err)
+		return false
+	}
+	return true
+}
+
+// withDefaults fills in the status and version of reports sent without them, copying the
+// batch only when one needs it.
+func withDefaults(reports []domain.Report) []domain.Report {
+	for _, report := range reports {
+		if report.Status == "" || report.Version == 0 {
+			filled := make([]domain.Report, len(reports))
+			for i, report := range reports {
+				filled[i] = report.WithDefaults()
+			}
+			return filled
+		}
+	}
+	return reports
+}
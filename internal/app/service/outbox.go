@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hexgonaldb/internal/domain"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrOutboxNeedsPostgres = errors.New("the outbox needs postgres configured")
+
+// DeadLetterOutbox is the backend of dead letters from outbox writes, replaying them with
+// WriteOutbox commits them to Postgres with an outbox entry again.
+const DeadLetterOutbox = "outbox"
+
+// EnableOutbox switches WriteReports to the transactional outbox: reports are committed to
+// Postgres together with an outbox entry, and a Relay delivers them to the other backends.
+// WriteReportsTo keeps writing every backend directly, benchmarks compare raw insert speed.
+func (s *Service) EnableOutbox() error {
+	if s.postgres == nil {
+		return ErrOutboxNeedsPostgres
+	}
+	s.outbox = true
+	return nil
+}
+
+// OutboxTargets returns the backends the outbox delivers to.
+func (s *Service) OutboxTargets() []string {
+	var targets []string
+	for _, backend := range s.Backends() {
+		if backend != BackendPostgres {
+			targets = append(targets, backend)
+		}
+	}
+	return targets
+}
+
+// WriteOutbox commits the reports to Postgres with an outbox entry, retried by Postgres'
+// RetryPolicy and dead-lettered as DeadLetterOutbox when it still fails. The result is
+// Postgres'.
+func (s *Service) WriteOutbox(ctx context.Context, reports []domain.Report) BackendResult {
+	reports = withDefaults(reports)
+
+	err := ctx.Err()
+	if s.postgres == nil {
+		err = ErrOutboxNeedsPostgres
+	}
+	return s.writeRetrying(ctx, BackendPostgres, DeadLetterOutbox, reports, err, func() (int64, error) {
+		return s.postgres.CreateReportsWithOutbox(reports, s.OutboxTargets())
+	})
+}
+
+type RelayConfig struct {
+	BatchSize    int           // outbox entries read at once
+	PollInterval time.Duration // wait between polls when nothing is pending
+	MinBackoff   time.Duration // first retry delay after a failed delivery, doubled up to MaxBackoff
+	MaxBackoff   time.Duration
+	PruneEvery   time.Duration // how often fully delivered entries are deleted
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		BatchSize:    10,
+		PollInterval: time.Second,
+		MinBackoff:   500 * time.Millisecond,
+		MaxBackoff:   time.Minute,
+		PruneEvery:   time.Minute,
+	}
+}
+
+// RelayStatus is the replication state of one target.
+type RelayStatus struct {
+	Target          string        `json:"target"`
+	Backlog         int64         `json:"backlog"` // entries not delivered yet
+	Lag             time.Duration `json:"-"`       // age of the oldest entry not delivered yet
+	LagSeconds      float64       `json:"lag_seconds"`
+	Delivered       int64         `json:"delivered"`  // entries delivered since start
+	Rows            int64         `json:"rows"`       // rows inserted since start
+	Duplicates      int64         `json:"duplicates"` // rows the target already had, as far as DuplicatesScope goes
+	DuplicatesScope string        `json:"duplicates_scope"`
+	Unattributed    int64         `json:"unattributed"` // rows a write buffer couldn't tell inserted or duplicate
+	Failures        int64         `json:"failures"`     // failed delivery attempts since start
+	LastError       string        `json:"last_error,omitempty"`
+	LastSuccess     time.Time     `json:"last_success"`
+}
+
+// Relay delivers outbox entries to every target, one goroutine per target so a slow or
+// failing backend doesn't hold the others back. Entries are delivered oldest first and
+// retried with backoff until they succeed; writes are idempotent, so an entry delivered
+// twice after a crash between the insert and the ack doesn't double count.
+type Relay struct {
+	svc *Service
+	cfg RelayConfig
+
+	mu     sync.Mutex
+	status map[string]*RelayStatus
+}
+
+func NewRelay(svc *Service, cfg RelayConfig) *Relay {
+	r := &Relay{svc: svc, cfg: cfg, status: make(map[string]*RelayStatus)}
+	for _, target := range svc.OutboxTargets() {
+		r.status[target] = &RelayStatus{Target: target, DuplicatesScope: DuplicateScope(target)}
+	}
+	return r
+}
+
+// Run delivers until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range r.svc.OutboxTargets() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.deliver(ctx, target)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.prune(ctx)
+	}()
+
+	wg.Wait()
+}
+
+// Status returns the state of every target in OutboxTargets order.
+func (r *Relay) Status() []RelayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]RelayStatus, 0, len(r.status))
+	for _, target := range r.svc.OutboxTargets() {
+		s := *r.status[target]
+		s.LagSeconds = s.Lag.Seconds()
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Drain waits until nothing is pending for any target, or ctx is done.
+func (r *Relay) Drain(ctx context.Context) error {
+	for {
+		pending := false
+		for _, target := range r.svc.OutboxTargets() {
+			count, _, err := r.svc.postgres.OutboxBacklog(target)
+			if err != nil || count > 0 {
+				pending = true
+			}
+		}
+		if !pending {
+			return nil
+		}
+
+		if !sleep(ctx, r.cfg.PollInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Relay) deliver(ctx context.Context, target string) {
+	backoff := r.cfg.MinBackoff
+
+	fail := func(err error) {
+		if ctx.Err() != nil {
+			return // shutting down, not a delivery failure
+		}
+		r.update(target, func(s *RelayStatus) {
+			s.Failures++
+			s.LastError = err.Error()
+		})
+		log.Printf("[outbox] delivery to %s failed, retrying in %s: %v", target, backoff, err)
+
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, r.cfg.MaxBackoff)
+	}
+
+	for ctx.Err() == nil {
+		read, err := r.deliverBatch(ctx, target)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		backoff = r.cfg.MinBackoff
+
+		count, oldest, err := r.svc.postgres.OutboxBacklog(target)
+		if err == nil {
+			r.update(target, func(s *RelayStatus) {
+				s.Backlog = count
+				s.Lag = 0
+				if !oldest.IsZero() {
+					s.Lag = time.Since(oldest)
+				}
+			})
+		}
+
+		if read < r.cfg.BatchSize {
+			sleep(ctx, r.cfg.PollInterval)
+		}
+	}
+}
+
+// deliverBatch reads the next entries for target and delivers them in order, stopping at
+// the first that fails. It runs under the erasure fence, so a player's reports read here
+// are written before their deletion starts, and entries read afterwards no longer hold them.
+func (r *Relay) deliverBatch(ctx context.Context, target string) (int, error) {
+	r.svc.erasing.RLock()
+	defer r.svc.erasing.RUnlock()
+
+	entries, err := r.svc.postgres.ReadOutbox(target, r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		result := r.svc.writeBackend(ctx, target, entry.Reports, r.svc.WriteOptions())
+		if !result.Success && !result.DeadLettered {
+			return 0, errors.New(result.Error)
+		}
+		// a permanent failure lives on in the dead-letter store, holding the queue for it helps nobody
+		if result.DeadLettered {
+			log.Printf("[outbox] entry %d dead-lettered for %s: %s", entry.ID, target, result.Error)
+			r.update(target, func(s *RelayStatus) { s.Failures++ })
+		}
+		if err := r.svc.postgres.AckOutbox(target, entry.ID); err != nil {
+			return 0, err
+		}
+
+		r.update(target, func(s *RelayStatus) {
+			s.Delivered++
+			s.Rows += int64(result.Rows)
+			s.Duplicates += int64(result.Duplicates)
+			s.Unattributed += int64(result.Unattributed)
+			s.LastError = ""
+			s.LastSuccess = time.Now()
+		})
+	}
+	return len(entries), nil
+}
+
+func (r *Relay) prune(ctx context.Context) {
+	for sleep(ctx, r.cfg.PruneEvery) {
+		if _, err := r.svc.postgres.PruneOutbox(); err != nil {
+			log.Printf("[outbox] prune error: %v", err)
+		}
+	}
+}
+
+func (r *Relay) update(target string, fn func(*RelayStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.status[target])
+}
+
+// sleep waits for d and reports whether ctx is still alive.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hexgonaldb/internal/domain"
+	"math"
+	"strings"
+	"time"
+)
+
+// PseudonymizeConfig controls how production exports are masked before seeding.
+type PseudonymizeConfig struct {
+	Key          []byte        // secret HMAC key, the same key always maps a value to the same pseudonym
+	TimeJitter   time.Duration // shift bet times by up to +/- TimeJitter, 0 keeps them as is
+	AmountJitter float64       // scale amounts by up to +/- AmountJitter (0.05 = 5%), 0 keeps them as is
+}
+
+// Pseudonymizer replaces player and transaction identifiers with keyed hashes. Equal
+// inputs give equal outputs, so per-player and per-round grouping survives, while the
+// originals can't be recovered without the key. Jitter is derived from the round, so all
+// reports of one round move together.
+type Pseudonymizer struct {
+	cfg PseudonymizeConfig
+}
+
+func NewPseudonymizer(cfg PseudonymizeConfig) (*Pseudonymizer, error) {
+	if len(cfg.Key) == 0 {
+		return nil, errors.New("pseudonymize key is required")
+	}
+	if cfg.AmountJitter < 0 || cfg.AmountJitter >= 1 {
+		return nil, errors.New("amount jitter must be in [0, 1)")
+	}
+	return &Pseudonymizer{cfg: cfg}, nil
+}
+
+func (p *Pseudonymizer) Apply(r domain.Report) domain.Report {
+	username := p.hash("username", r.Username)
+
+	// keep the provider suffix of username_game readable, it's not personal data
+	if suffix, ok := strings.CutPrefix(r.UsernameGame, r.Username+"_"); ok {
+		r.UsernameGame = username + "_" + suffix
+	} else {
+		r.UsernameGame = p.hash("username_game", r.UsernameGame)
+	}
+	r.Username = username
+
+	roundSum := p.sum("jitter", r.RoundID)
+
+	if p.cfg.TimeJitter > 0 {
+		span := int64(p.cfg.TimeJitter/time.Second)*2 + 1
+		offset := int64(binary.BigEndian.Uint64(roundSum[:8])%uint64(span)) - span/2
+		r.BetTime = r.BetTime.Add(time.Duration(offset) * time.Second)
+	}
+
+	if p.cfg.AmountJitter > 0 {
+		unit := float64(binary.BigEndian.Uint64(roundSum[8:16])>>11) / (1 << 53) // [0, 1)
+		factor := 1 + (unit*2-1)*p.cfg.AmountJitter
+		r.Bet = int64(math.Round(float64(r.Bet) * factor))
+		r.Turnover = int64(math.Round(float64(r.Turnover) * factor))
+		r.Winloss = int64(math.Round(float64(r.Winloss) * factor))
+	}
+
+	r.TransactionID = p.hash("transaction_id", r.TransactionID)
+	r.RoundID = p.hash("round_id", r.RoundID)
+
+	return r
+}
+
+// Stream pseudonymizes every batch from in. The output is closed once in is drained or ctx is done.
+func (p *Pseudonymizer) Stream(ctx context.Context, in <-chan []domain.Report) <-chan []domain.Report {
+	out := make(chan []domain.Report, 1)
+
+	go func() {
+		defer close(out)
+
+		for batch := range in {
+			for i := range batch {
+				batch[i] = p.Apply(batch[i])
+			}
+
+			select {
+			case out <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func (p *Pseudonymizer) hash(field, value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := p.sum(field, value)
+	return hex.EncodeToString(sum[:16])
+}
+
+// sum prefixes the field name so equal values in different fields get different pseudonyms.
+func (p *Pseudonymizer) sum(field, value string) []byte {
+	mac := hmac.New(sha256.New, p.cfg.Key)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
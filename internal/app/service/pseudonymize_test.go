@@ -0,0 +1,64 @@
+package service
+
+import (
+	"hexgonaldb/internal/domain"
+	"testing"
+	"time"
+)
+
+func pseudonymizer(t *testing.T, key string) *Pseudonymizer {
+	t.Helper()
+	p, err := NewPseudonymizer(PseudonymizeConfig{Key: []byte(key), TimeJitter: time.Hour, AmountJitter: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPseudonymizerKey(t *testing.T) {
+	report := domain.Report{
+		Username:      "alice",
+		UsernameGame:  "alice_slots",
+		TransactionID: "tx1",
+		RoundID:       "round1",
+		BetTime:       time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC),
+		Bet:           1000,
+		Turnover:      1000,
+		Winloss:       -400,
+	}
+
+	a := pseudonymizer(t, "key-a").Apply(report)
+	if again := pseudonymizer(t, "key-a").Apply(report); again != a {
+		t.Fatalf("same key gave\n%+v\n%+v", a, again)
+	}
+	if a.Username == report.Username || a.TransactionID == report.TransactionID || a.RoundID == report.RoundID {
+		t.Fatalf("identifiers kept: %+v", a)
+	}
+	if a.UsernameGame != a.Username+"_slots" {
+		t.Fatalf("username_game %q doesn't keep the suffix of %q", a.UsernameGame, a.Username)
+	}
+
+	b := pseudonymizer(t, "key-b").Apply(report)
+	if b.Username == a.Username || b.TransactionID == a.TransactionID || b.RoundID == a.RoundID {
+		t.Fatalf("different keys gave the same pseudonyms:\n%+v\n%+v", a, b)
+	}
+
+	// reports of one round move together, whatever else differs
+	other := report
+	other.Username, other.TransactionID = "bob", "tx2"
+	if o := pseudonymizer(t, "key-a").Apply(other); !o.BetTime.Equal(a.BetTime) || o.RoundID != a.RoundID {
+		t.Fatalf("one round jittered apart: %v and %v", a.BetTime, o.BetTime)
+	}
+}
+
+func TestNewPseudonymizerRejects(t *testing.T) {
+	for name, cfg := range map[string]PseudonymizeConfig{
+		"no key":            {},
+		"negative jitter":   {Key: []byte("k"), AmountJitter: -0.1},
+		"jitter of a whole": {Key: []byte("k"), AmountJitter: 1},
+	} {
+		if _, err := NewPseudonymizer(cfg); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hexgonaldb/internal/domain"
+	"time"
+)
+
+var (
+	ErrUnknownBackend       = errors.New("unknown backend")
+	ErrBackendNotConfigured = errors.New("backend not configured")
+)
+
+// checkBackend makes sure backend names one of the configured backends.
+func (s *Service) checkBackend(backend string) error {
+	switch backend {
+	case BackendPostgres, BackendMongo, BackendClickHouse:
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownBackend, backend)
+	}
+	for _, b := range s.Backends() {
+		if b == backend {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrBackendNotConfigured, backend)
+}
+
+func (s *Service) CountReports(backend string, f domain.ReportFilter) (time.Duration, int64, error) {
+	if err := s.checkBackend(backend); err != nil {
+		return 0, 0, err
+	}
+
+	switch backend {
+	case BackendPostgres:
+		return s.postgres.CountReportsWhere(f)
+	case BackendMongo:
+		return s.mongo.CountReportsWhere("reports", f)
+	default:
+		return s.click.CountReportsWhere(f)
+	}
+}
+
+func (s *Service) ProfitByGame(backend string, f domain.ReportFilter) (time.Duration, []domain.ProfitAggregationResult, error) {
+	if err := s.checkBackend(backend); err != nil {
+		return 0, nil, err
+	}
+
+	switch backend {
+	case BackendPostgres:
+		return s.postgres.ProfitByGame(f)
+	case BackendMongo:
+		return s.mongo.ProfitByGame("reports", f)
+	default:
+		return s.click.ProfitByGame(f)
+	}
+}
+
+// Rollup groups reports by time bucket, brand and game.
+func (s *Service) Rollup(backend string, f domain.ReportFilter, g domain.Granularity) (time.Duration, []domain.SuperAggregationResult, error) {
+	if err := s.checkBackend(backend); err != nil {
+		return 0, nil, err
+	}
+	if !g.Valid() {
+		return 0, nil, fmt.Errorf("unknown granularity %q", g)
+	}
+
+	switch backend {
+	case BackendPostgres:
+		return s.postgres.Rollup(f, g)
+	case BackendMongo:
+		return s.mongo.Rollup("reports", f, g)
+	default:
+		return s.click.Rollup(f, g)
+	}
+}
+
+// ListReports returns a page of up to limit reports after the cursor in (bet_time,
+// transaction_id) order, and the cursor of the next page, nil on the last page.
+func (s *Service) ListReports(backend string, f domain.ReportFilter, after *domain.ReportCursor, limit int) (time.Duration, []domain.Report, *domain.ReportCursor, error) {
+	if err := s.checkBackend(backend); err != nil {
+		return 0, nil, nil, err
+	}
+	if limit <= 0 {
+		return 0, nil, nil, errors.New("limit must be positive")
+	}
+
+	// one extra row tells whether there is a next page without a second query
+	var (
+		took    time.Duration
+		reports []domain.Report
+		err     error
+	)
+	switch backend {
+	case BackendPostgres:
+		took, reports, err = s.postgres.ListReports(f, after, limit+1)
+	case BackendMongo:
+		took, reports, err = s.mongo.ListReports("reports", f, after, limit+1)
+	default:
+		took, reports, err = s.click.ListReports(f, after, limit+1)
+	}
+	if err != nil || len(reports) <= limit {
+		return took, reports, nil, err
+	}
+
+	reports = reports[:limit]
+	last := reports[limit-1]
+	return took, reports, &domain.ReportCursor{BetTime: last.BetTime, TransactionID: last.TransactionID}, nil
+}
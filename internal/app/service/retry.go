@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides how often and how patiently a failed write is retried.
+type RetryPolicy struct {
+	MaxAttempts int                  // attempts including the first, 1 disables retries
+	BaseDelay   time.Duration        // delay before the second attempt, doubled for every further one
+	MaxDelay    time.Duration        // cap of the doubled delay
+	Jitter      float64              // up to this fraction of each delay is randomly taken off, so writers don't retry in lockstep
+	Retryable   func(err error) bool // nil uses IsTransient
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.5,
+	}
+}
+
+// delay returns how long to wait after the given failed attempt, counted from 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	return d - time.Duration(rand.Float64()*p.Jitter*float64(d))
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// IsTransient reports errors any backend may recover from: timeouts, dropped and refused
+// connections. The adapters build on it with the error codes of their own database.
+func IsTransient(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// SetRetryPolicy replaces the retry policy of backend, DefaultRetryPolicy until then.
+func (s *Service) SetRetryPolicy(backend string, p RetryPolicy) {
+	if s.retries == nil {
+		s.retries = make(map[string]RetryPolicy)
+	}
+	s.retries[backend] = p
+}
+
+func (s *Service) retryPolicy(backend string) RetryPolicy {
+	if p, ok := s.retries[backend]; ok {
+		return p
+	}
+	return DefaultRetryPolicy()
+}
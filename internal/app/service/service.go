@@ -1,103 +1,65 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"hexgonaldb/internal/app"
 	"hexgonaldb/internal/domain"
-	"math/rand"
 	"runtime"
+	"sync"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 type Service struct {
-	postgres app.PostgresRepository
-	mongo    app.MongoRepository
-	click    app.ClickhouseRepository
+	postgres  app.PostgresRepository
+	mongo     app.MongoRepository
+	click     app.ClickhouseRepository
+	generator *Generator
+	outbox    bool // WriteReports goes through the transactional outbox, see EnableOutbox
+
+	writeOptions WriteOptions
+	retries      map[string]RetryPolicy // per backend, DefaultRetryPolicy when missing
+	deadLetters  app.DeadLetterStore    // nil drops batches that failed permanently
+	erasures     app.ErasureLog         // nil refuses DeletePlayerData, deletions must be audited
+
+	// held by DeletePlayerData, read by the relay around each batch it reads and delivers
+	erasing sync.RWMutex
 }
 
 func NewService(pg app.PostgresRepository, mongo app.MongoRepository, click app.ClickhouseRepository) *Service {
-	return &Service{pg, mongo, click}
+	generator, _ := NewGenerator(DefaultGeneratorConfig()) // the defaults are valid
+	return &Service{
+		postgres:  pg,
+		mongo:     mongo,
+		click:     click,
+		generator: generator,
+	}
 }
 
-// func (s *Service) GenerateReports(count int) []domain.Report {
-
-// 	fmt.Println("Generating reports...")
-
-// 	var reports []domain.Report
-// 	now := time.Now()
-
-// 	game := []string{"pgsoft", "evolution", "evolutionlive", "netent", "playtech", "pragmatic", "redtiger", "quickspin", "microgaming", "yggdrasil"}
-
-// 	completePercent := 0
-
-// 	for i := 0; i < count; i++ {
-
-// 		username := uuid.NewString()
-// 		usernameGame := fmt.Sprintf("%s_%s", username, game[rand.Intn(len(game))])
-
-// 		r := domain.Report{
-// 			Username:      username,
-// 			UsernameGame:  usernameGame,
-// 			Currency:      "USD",
-// 			Winloss:       rand.Int63n(10000) - 5000, // -5000 to +5000
-// 			Bet:           rand.Int63n(10000),
-// 			Turnover:      rand.Int63n(20000),
-// 			Payout:        rand.Float64() * 100,
-// 			BetTime:       now.Add(-time.Duration(rand.Intn(100000)) * time.Second),
-// 			BrandID:       fmt.Sprintf("brand%d", rand.Intn(10)),
-// 			BrandName:     fmt.Sprintf("Brand %d", rand.Intn(10)),
-// 			GameID:        fmt.Sprintf("game%d", rand.Intn(100)),
-// 			GameName:      fmt.Sprintf("Game %d", rand.Intn(100)),
-// 			GameType:      fmt.Sprintf("type%d", rand.Intn(5)),
-// 			TransactionID: fmt.Sprintf("tx%d", rand.Int63()),
-// 			RoundID:       fmt.Sprintf("round%d", rand.Int63()),
-// 		}
-// 		reports = append(reports, r)
-
-// 		completePercent = int((float64(i) / float64(count)) * 100)
-// 		if completePercent%2 == 0 {
-// 			fmt.Printf("\rGenerating reports... %d%% complete", completePercent)
-// 		}
-// 	}
+// GenerateReports returns the next count reports from the service generator.
+func (s *Service) GenerateReports(count int) []domain.Report {
+	return s.generator.Generate(count)
+}
 
-// 	return reports
-// }
+// StreamReports streams total reports from the service generator in batches of batchSize.
+// GenerateReports mustn't be called until the channel is closed, see Generator.Batches.
+func (s *Service) StreamReports(ctx context.Context, total, batchSize int) <-chan []domain.Report {
+	return s.generator.Batches(ctx, total, batchSize)
+}
 
-func (s *Service) GenerateReports(count int) []domain.Report {
-	var (
-		reports = make([]domain.Report, count)
-		now     = time.Now()
-		game    = []string{"pgsoft", "evolution", "evolutionlive", "netent", "playtech", "pragmatic", "redtiger", "quickspin", "microgaming", "yggdrasil"}
-	)
+// SetDeadLetters sets where batches that failed permanently are kept.
+func (s *Service) SetDeadLetters(store app.DeadLetterStore) {
+	s.deadLetters = store
+}
 
-	for i := 0; i < count; i++ {
-		r := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-		username := uuid.NewString()
-		usernameGame := fmt.Sprintf("%s_%s", username, game[r.Intn(len(game))])
-
-		reports[i] = domain.Report{
-			Username:      username,
-			UsernameGame:  usernameGame,
-			Currency:      "USD",
-			Winloss:       r.Int63n(10000) - 5000,
-			Bet:           r.Int63n(10000),
-			Turnover:      r.Int63n(20000),
-			Payout:        r.Float64() * 100,
-			BetTime:       now.Add(-time.Duration(r.Intn(100000)) * time.Minute),
-			BrandID:       fmt.Sprintf("brand%d", r.Intn(10)),
-			BrandName:     fmt.Sprintf("Brand %d", r.Intn(10)),
-			GameID:        fmt.Sprintf("game%d", r.Intn(100)),
-			GameName:      fmt.Sprintf("Game %d", r.Intn(100)),
-			GameType:      fmt.Sprintf("type%d", r.Intn(5)),
-			TransactionID: fmt.Sprintf("tx%d", r.Int63()),
-			RoundID:       fmt.Sprintf("round%d", r.Int63()),
-		}
+// SetErasureLog sets where player data deletions are audited.
+func (s *Service) SetErasureLog(erasures app.ErasureLog) {
+	s.erasures = erasures
+}
 
-	}
-	return reports
+// SetGenerator replaces the generator used by GenerateReports.
+func (s *Service) SetGenerator(g *Generator) {
+	s.generator = g
 }
 
 func FindDateRangeMongo(results []domain.MongoAggregationResult) (minDateStr, maxDateStr string, totalDays int, err error) {
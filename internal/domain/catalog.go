@@ -0,0 +1,26 @@
+package domain
+
+// Catalog holds the dimensions reports are generated from. IDs are stable, so
+// reports can be joined back to the catalog by ID or grouped by name interchangeably.
+type Catalog struct {
+	Brands    []Brand    `json:"brands"`
+	Providers []Provider `json:"providers"`
+	Games     []Game     `json:"games"`
+}
+
+type Brand struct {
+	ID   string `json:"brand_id"`
+	Name string `json:"brand_name"`
+}
+
+type Provider struct {
+	ID   string `json:"provider_id"`
+	Name string `json:"provider_name"`
+}
+
+type Game struct {
+	ID         string `json:"game_id"`
+	Name       string `json:"game_name"`
+	Type       string `json:"game_type"`
+	ProviderID string `json:"provider_id"`
+}
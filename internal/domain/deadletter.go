@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// DeadLetter is a batch a backend rejected for good, kept so it can be replayed once the
+// cause is fixed.
+type DeadLetter struct {
+	Backend  string    `json:"backend"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+	Reports  []Report  `json:"reports"`
+}
@@ -1,6 +1,19 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ReportStatus is where a bet stands after settlement. Providers void or resettle bets
+// after the fact by sending the report again with another status and a higher version.
+type ReportStatus string
+
+const (
+	Settled   ReportStatus = "settled"
+	Void      ReportStatus = "void" // left out of every aggregation
+	Resettled ReportStatus = "resettled"
+)
 
 type Report struct {
 	Username      string    `json:"username" bson:"username"`
@@ -18,6 +31,65 @@ type Report struct {
 	GameType      string    `json:"game_type" bson:"game_type"`
 	TransactionID string    `json:"transaction_id" bson:"transaction_id"`
 	RoundID       string    `json:"round_id" bson:"round_id"`
+
+	// only the highest version of a transaction counts, reports from before corrections
+	// existed are version 1 and settled
+	Status  ReportStatus `json:"status,omitempty" bson:"status" gorm:"default:settled"`
+	Version uint32       `json:"version,omitempty" bson:"version" gorm:"default:1"`
+}
+
+// WithDefaults returns r with the status and version a report without them stands for.
+func (r Report) WithDefaults() Report {
+	if r.Status == "" {
+		r.Status = Settled
+	}
+	if r.Version == 0 {
+		r.Version = 1
+	}
+	return r
+}
+
+// Validate checks the fields every backend relies on are present and sane.
+func (r Report) Validate() error {
+	switch {
+	case r.Username == "":
+		return errors.New("username is required")
+	case r.TransactionID == "":
+		return errors.New("transaction_id is required")
+	case r.BetTime.IsZero():
+		return errors.New("bet_time is required")
+	case r.BrandID == "":
+		return errors.New("brand_id is required")
+	case r.GameID == "":
+		return errors.New("game_id is required")
+	case r.Currency == "":
+		return errors.New("currency is required")
+	case r.Bet < 0:
+		return errors.New("bet must not be negative")
+	case r.Turnover < 0:
+		return errors.New("turnover must not be negative")
+	}
+
+	switch r.Status {
+	case "", Settled, Void, Resettled:
+	default:
+		return errors.New("status must be settled, void or resettled")
+	}
+	return nil
+}
+
+// ValidateCorrection checks r can replace an earlier version of its transaction.
+func (r Report) ValidateCorrection() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	switch {
+	case r.Status != Void && r.Status != Resettled:
+		return errors.New("a correction's status must be void or resettled")
+	case r.Version < 2:
+		return errors.New("a correction's version must be above 1")
+	}
+	return nil
 }
 
 type AggregationResult struct {
@@ -35,6 +107,7 @@ type SuperAggregationResult struct {
 	AveragePayout float64 `json:"average_payout"`
 	TotalCount    uint64  `json:"total_count"`
 	PositiveWin   int64   `json:"positive_win"`
+	TotalWinloss  int64   `json:"total_winloss"` // only set by Rollup
 }
 
 type MongoAggregationResult struct {
@@ -48,6 +121,7 @@ type MongoAggregationResult struct {
 	AveragePayout float64 `bson:"average_payout"`
 	TotalCount    int64   `bson:"total_count"`
 	PositiveWin   int64   `bson:"positive_win"`
+	TotalWinloss  int64   `bson:"total_winloss"`
 }
 
 type ProfitAggregationResult struct {
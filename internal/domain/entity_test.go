@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateCorrection(t *testing.T) {
+	valid := Report{
+		Username:      "player",
+		TransactionID: "tx1",
+		BetTime:       time.Date(2024, time.May, 1, 10, 0, 0, 0, time.UTC),
+		BrandID:       "brand",
+		GameID:        "game",
+		Currency:      "USD",
+		Status:        Void,
+		Version:       2,
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(r *Report)
+		wantErr string
+	}{
+		{"void", func(r *Report) {}, ""},
+		{"resettled", func(r *Report) { r.Status = Resettled; r.Version = 7 }, ""},
+		{"settled", func(r *Report) { r.Status = Settled }, "a correction's status must be void or resettled"},
+		{"no status", func(r *Report) { r.Status = "" }, "a correction's status must be void or resettled"},
+		{"unknown status", func(r *Report) { r.Status = "cancelled" }, "status must be settled, void or resettled"},
+		{"first version", func(r *Report) { r.Version = 1 }, "a correction's version must be above 1"},
+		{"no version", func(r *Report) { r.Version = 0 }, "a correction's version must be above 1"},
+		{"no transaction id", func(r *Report) { r.TransactionID = "" }, "transaction_id is required"},
+		{"no bet time", func(r *Report) { r.BetTime = time.Time{} }, "bet_time is required"},
+		{"negative bet", func(r *Report) { r.Bet = -1 }, "bet must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid
+			tt.edit(&r)
+
+			err := r.ValidateCorrection()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	tests := []struct {
+		in   Report
+		want Report
+	}{
+		{Report{}, Report{Status: Settled, Version: 1}},
+		{Report{Status: Void}, Report{Status: Void, Version: 1}},
+		{Report{Version: 3}, Report{Status: Settled, Version: 3}},
+		{Report{Status: Resettled, Version: 2}, Report{Status: Resettled, Version: 2}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.WithDefaults(); got != tt.want {
+			t.Errorf("%+v.WithDefaults() = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
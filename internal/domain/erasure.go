@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// Erasure is the audit record of deleting one player's reports. The username itself isn't
+// kept, Subject is its SHA-256 so a request can still be matched to its record.
+type Erasure struct {
+	ID          string         `json:"id"`
+	Subject     string         `json:"subject"`
+	RequestedAt time.Time      `json:"requested_at"`
+	FinishedAt  time.Time      `json:"finished_at"`
+	Stores      []ErasureStore `json:"stores"`
+}
+
+// ErasureStore is what one backend removed.
+type ErasureStore struct {
+	Backend string  `json:"backend"`
+	Deleted int64   `json:"deleted"`
+	TookMs  float64 `json:"took_ms"`
+	Error   string  `json:"error,omitempty"`
+}
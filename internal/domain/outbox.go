@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// OutboxEntry is a batch of reports committed to Postgres that still has to be delivered
+// to another backend.
+type OutboxEntry struct {
+	ID        int64
+	CreatedAt time.Time
+	Reports   []Report
+}
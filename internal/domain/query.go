@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// ReportFilter narrows queries down, zero fields don't filter.
+type ReportFilter struct {
+	From    time.Time // inclusive
+	To      time.Time // exclusive
+	BrandID string
+	GameID  string
+}
+
+// Granularity is the size of the time buckets a rollup groups by.
+type Granularity string
+
+const (
+	Hour  Granularity = "hour"
+	Day   Granularity = "day"
+	Week  Granularity = "week" // weeks start on Monday
+	Month Granularity = "month"
+)
+
+func (g Granularity) Valid() bool {
+	switch g {
+	case Hour, Day, Week, Month:
+		return true
+	}
+	return false
+}
+
+// ReportCursor is the position of a report in (bet_time, transaction_id) order, the order
+// report listings are paged in.
+type ReportCursor struct {
+	BetTime       time.Time
+	TransactionID string
+}